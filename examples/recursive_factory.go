@@ -12,17 +12,14 @@ type User struct {
 	CloseFriend *User
 }
 
-var UserFactory = factory.NewFactory(
+// factory.Ref("user") refers to the factory registered as "user", so the factory can refer to itself.
+var UserFactory = factory.Register("user", factory.NewFactory(
 	&User{},
-)
-
-func init() {
-	UserFactory.SeqInt("ID", func(n int) (interface{}, error) {
-		return n, nil
-	}).Attr("Name", func(args factory.Args) (interface{}, error) {
-		return randomdata.FullName(randomdata.RandomGender), nil
-	}).SubRecursiveFactory("CloseFriend", UserFactory, func() int { return 2 }) // recursive depth is always 2
-}
+).SeqInt("ID", func(n int) (interface{}, error) {
+	return n, nil
+}).Attr("Name", func(args factory.Args) (interface{}, error) {
+	return randomdata.FullName(randomdata.RandomGender), nil
+}).SubRecursiveFactory("CloseFriend", factory.Ref("user"), func() int { return 2 })) // recursive depth is always 2
 
 func main() {
 	user := UserFactory.MustCreate().(*User)
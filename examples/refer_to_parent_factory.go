@@ -24,13 +24,7 @@ var UserFactory = factory.NewFactory(
 }).Attr("Name", func(args factory.Args) (interface{}, error) {
 	user := args.Instance().(*User)
 	return fmt.Sprintf("user-%d", user.ID), nil
-}).Attr("Group", func(args factory.Args) (interface{}, error) {
-	if parent := args.Parent(); parent != nil {
-		// if args have parent, use it.
-		return parent.Instance(), nil
-	}
-	return nil, nil
-})
+}).BackRef("Group") // if the user is created by GroupFactory, the parent group is assigned.
 
 var GroupFactory = factory.NewFactory(
 	&Group{},
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"github.com/bluele/factory-go/factory"
+)
+
+type User struct {
+	ID    int
+	Email string
+}
+
+type Group struct {
+	ID      int
+	Members map[string]*User
+}
+
+var UserFactory = factory.NewFactory(
+	&User{},
+).SeqInt("ID", func(n int) (interface{}, error) {
+	return n, nil
+}).Attr("Email", func(args factory.Args) (interface{}, error) {
+	user := args.Instance().(*User)
+	return fmt.Sprintf("user-%d@example.com", user.ID), nil
+})
+
+var GroupFactory = factory.NewFactory(
+	&Group{},
+).SeqInt("ID", func(n int) (interface{}, error) {
+	return n, nil
+}).SubMapFactory("Members", UserFactory, func() int { return 3 }, func(args factory.Args) (interface{}, error) {
+	// each member is keyed by its own email.
+	return args.Instance().(*User).Email, nil
+})
+
+func main() {
+	group := GroupFactory.MustCreate().(*Group)
+	fmt.Println("Group.ID:", group.ID)
+	for email, user := range group.Members {
+		fmt.Println("\tKey:", email, " User.ID:", user.ID)
+	}
+}
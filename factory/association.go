@@ -0,0 +1,362 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrLimitExceeded is returned when a create call exceeds MaxDepth or MaxObjects.
+var ErrLimitExceeded = errors.New("factory: limit exceeded")
+
+// CycleError is returned when sub-factories refer to each other without SubRecursiveFactory.
+type CycleError struct {
+	// Path is the model names on the creation path from the first object whose attribute repeats
+	// to the object which would repeat it, e.g. ["User", "Group", "User"].
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return "factory: cycle detected: " + strings.Join(e.Path, " -> ")
+}
+
+// AssocOption configures how a sub-factory attribute obtains its objects.
+type AssocOption interface {
+	applyAssoc(*association)
+}
+
+type assocOptionFunc func(*association)
+
+func (f assocOptionFunc) applyAssoc(as *association) {
+	f(as)
+}
+
+type association struct {
+	name     string
+	sub      *Factory
+	choose   Chooser // chooses the factory instead of sub for polymorphic attributes
+	strategy strategy
+	elements func(i int, args Args) map[string]interface{}
+	sizeFunc func(Args) int
+	treeSize func(depth int, args Args) int
+	maxNodes int
+}
+
+func newAssociation(name string, sub *Factory, opts []AssocOption) *association {
+	as := &association{name: name, sub: sub}
+	for _, opt := range opts {
+		opt.applyAssoc(as)
+	}
+	return as
+}
+
+// with returns a copy of the association with opt applied.
+func (as *association) with(opt AssocOption) *association {
+	cp := *as
+	opt.applyAssoc(&cp)
+	return &cp
+}
+
+// size returns the number of objects for a slice or map attribute.
+func (as *association) size(args Args, getSize func() int) int {
+	switch {
+	case as.sizeFunc != nil:
+		return as.sizeFunc(args)
+	case as.treeSize != nil:
+		return as.treeSize(treeDepth(args), args)
+	}
+	return getSize()
+}
+
+// get returns an object for the association, either newly created by the sub factory or picked by the strategy.
+// index is the element index for slice attributes, or -1.
+func (as *association) get(args Args, pl *pipeline, index int) (interface{}, error) {
+	create := func() (interface{}, error) {
+		sub, err := as.factory(args)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkCycle(args, as); err != nil {
+			return nil, err
+		}
+		return sub.create(args.Context(), as.elementOptions(index, args), pl.Next(args).at(as.name, index).from(as))
+	}
+	if as.strategy == nil {
+		return create()
+	}
+	return as.strategy.pick(pl, create)
+}
+
+// factory returns the factory which creates the next object.
+func (as *association) factory(args Args) (*Factory, error) {
+	if as.choose == nil {
+		return as.sub, nil
+	}
+	sub, err := as.choose(args)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, fmt.Errorf("factory: no factory is chosen for attribute %v", as.name)
+	}
+	return sub, nil
+}
+
+// elementOptions returns the attribute values for the i-th element. The object of SubFactory is treated as the 0th element.
+func (as *association) elementOptions(i int, args Args) map[string]interface{} {
+	if as.elements == nil {
+		return nil
+	}
+	if i < 0 {
+		i = 0
+	}
+	return as.elements(i, args)
+}
+
+// AssocOptions combines several options into one,
+// e.g. map[string]interface{}{"Users": factory.AssocOptions(factory.Count(3), factory.Elements{owner})}.
+func AssocOptions(opts ...AssocOption) AssocOption {
+	return assocOptionFunc(func(as *association) {
+		for _, opt := range opts {
+			opt.applyAssoc(as)
+		}
+	})
+}
+
+// Elements gives attribute values to the elements of a slice or map attribute: Elements[i] is used for the i-th element.
+// SubFactory uses Elements[0] for its object.
+// Each map can apply traits with TraitsAttr. Objects reused by a strategy are not affected.
+type Elements []map[string]interface{}
+
+func (e Elements) applyAssoc(as *association) {
+	as.elements = func(i int, args Args) map[string]interface{} {
+		if i < len(e) {
+			return e[i]
+		}
+		return nil
+	}
+}
+
+// ElementsFunc returns attribute values for the i-th element of a slice or map attribute.
+type ElementsFunc func(i int, args Args) map[string]interface{}
+
+func (f ElementsFunc) applyAssoc(as *association) {
+	as.elements = f
+}
+
+// Size determines the size of a slice or map attribute instead of getSize.
+func Size(getSize func(Args) int) AssocOption {
+	return assocOptionFunc(func(as *association) {
+		as.sizeFunc = getSize
+		as.treeSize = nil
+	})
+}
+
+// Count fixes the size of a slice or map attribute.
+// It can also be given as an attribute value at creation time, e.g. map[string]interface{}{"Posts": factory.Count(10)}.
+type Count int
+
+func (c Count) applyAssoc(as *association) {
+	Size(func(Args) int { return int(c) }).applyAssoc(as)
+}
+
+// TreeSize determines the size of each level of SubRecursiveSliceFactory instead of getSize.
+// depth is 0 for the objects created by the root of the tree.
+func TreeSize(getSize func(depth int, args Args) int) AssocOption {
+	return assocOptionFunc(func(as *association) {
+		as.sizeFunc = nil
+		as.treeSize = getSize
+	})
+}
+
+// MaxNodes limits the number of objects in a tree created by SubRecursiveSliceFactory.
+// The objects are created depth-first, so the last subtrees can be smaller than the others.
+func MaxNodes(n int) AssocOption {
+	return assocOptionFunc(func(as *association) {
+		as.maxNodes = n
+	})
+}
+
+type budget struct {
+	left int64
+}
+
+// take consumes up to n from the budget and returns the consumed size.
+func (b *budget) take(n int) int {
+	for {
+		left := atomic.LoadInt64(&b.left)
+		taken := int64(n)
+		if taken > left {
+			taken = left
+		}
+		if atomic.CompareAndSwapInt64(&b.left, left, left-taken) {
+			return int(taken)
+		}
+	}
+}
+
+type strategy interface {
+	pick(pl *pipeline, create func() (interface{}, error)) (interface{}, error)
+}
+
+// checkCycle returns a CycleError if as already created an object on the creation path of args
+// without a recursive sub-factory in between, which would repeat the attribute without limit.
+func checkCycle(args Args, as *association) error {
+	var path []string
+	for current := args; current != nil; current = current.Parent() {
+		path = append(path, current.Factory().modelName())
+		pl := current.(*argsStruct).pl
+		if pl == nil || pl.bounded {
+			return nil
+		}
+		if pl.assoc == as {
+			path = append(path, current.Parent().Factory().modelName())
+			for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+				path[i], path[j] = path[j], path[i]
+			}
+			return &CycleError{Path: path}
+		}
+	}
+	return nil
+}
+
+// scope holds the state shared by all objects created in a single create call.
+type scope struct {
+	mu      sync.Mutex
+	values  map[interface{}]interface{}
+	objects int64
+}
+
+// enter counts the object and checks MaxDepth and MaxObjects.
+func (sc *scope) enter(args Args) error {
+	if MaxDepth > 0 && args.Depth() > MaxDepth {
+		return fmt.Errorf("%w: depth of %v exceeds %v", ErrLimitExceeded, args.Path(), MaxDepth)
+	}
+	if n := atomic.AddInt64(&sc.objects, 1); MaxObjects > 0 && n > int64(MaxObjects) {
+		return fmt.Errorf("%w: more than %v objects are created", ErrLimitExceeded, MaxObjects)
+	}
+	return nil
+}
+
+func newScope() *scope {
+	return &scope{values: make(map[interface{}]interface{})}
+}
+
+func (sc *scope) get(key interface{}) (interface{}, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	v, ok := sc.values[key]
+	return v, ok
+}
+
+func (sc *scope) set(key, value interface{}) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.values[key] = value
+}
+
+// AlwaysNew creates a new object every time. This is the default strategy.
+func AlwaysNew() AssocOption {
+	return assocOptionFunc(func(as *association) {
+		as.strategy = nil
+	})
+}
+
+// ReusePerScope creates one object per create call and reuses it for every object in the call.
+func ReusePerScope() AssocOption {
+	return assocOptionFunc(func(as *association) {
+		as.strategy = &scopeStrategy{as: as}
+	})
+}
+
+// scopeStrategy is the key of its object in the scope, so it must not be zero-size: pointers to zero-size values may be equal.
+type scopeStrategy struct {
+	as *association
+}
+
+func (st *scopeStrategy) pick(pl *pipeline, create func() (interface{}, error)) (interface{}, error) {
+	if v, ok := pl.scope.get(st); ok {
+		return v, nil
+	}
+	v, err := create()
+	if err != nil {
+		return nil, err
+	}
+	pl.scope.set(st, v)
+	return v, nil
+}
+
+// RoundRobin creates up to `size` objects on demand and then hands them out in turn.
+func RoundRobin(size int) AssocOption {
+	if size <= 0 {
+		panic("RoundRobin: size should be positive")
+	}
+	return assocOptionFunc(func(as *association) {
+		as.strategy = &poolStrategy{slots: make([]interface{}, size), next: func(n int) int { return n % size }}
+	})
+}
+
+// RandomPick picks a random slot of a pool of `size` objects, creating the object if the slot is still empty.
+func RandomPick(size int) AssocOption {
+	if size <= 0 {
+		panic("RandomPick: size should be positive")
+	}
+	return assocOptionFunc(func(as *association) {
+		as.strategy = &poolStrategy{slots: make([]interface{}, size), next: func(int) int { return random.intn(size) }}
+	})
+}
+
+type poolStrategy struct {
+	mu    sync.Mutex
+	count int
+	slots []interface{}
+	next  func(count int) int
+}
+
+func (st *poolStrategy) pick(pl *pipeline, create func() (interface{}, error)) (interface{}, error) {
+	st.mu.Lock()
+	slot := st.next(st.count)
+	st.count++
+	v := st.slots[slot]
+	st.mu.Unlock()
+	if v != nil {
+		return v, nil
+	}
+
+	// create without holding the lock, so the sub factory may use this pool recursively.
+	v, err := create()
+	if err != nil {
+		return nil, err
+	}
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.slots[slot] == nil {
+		st.slots[slot] = v
+	}
+	return st.slots[slot], nil
+}
+
+// PickFrom picks a random element of `values`, which must be a slice, instead of creating a new object.
+func PickFrom(values interface{}) AssocOption {
+	rv := reflect.ValueOf(values)
+	if rv.Kind() != reflect.Slice {
+		panic("PickFrom: values should be a slice")
+	}
+	if rv.Len() == 0 {
+		panic("PickFrom: values should not be empty")
+	}
+	return assocOptionFunc(func(as *association) {
+		as.strategy = &sliceStrategy{values: rv}
+	})
+}
+
+type sliceStrategy struct {
+	values reflect.Value
+}
+
+func (st *sliceStrategy) pick(pl *pipeline, create func() (interface{}, error)) (interface{}, error) {
+	return st.values.Index(random.intn(st.values.Len())).Interface(), nil
+}
@@ -0,0 +1,339 @@
+package factory
+
+import (
+	"errors"
+	"testing"
+)
+
+type assocGroup struct {
+	ID int
+}
+
+type assocUser struct {
+	ID     int
+	Group  *assocGroup
+	Groups []*assocGroup
+}
+
+func newAssocGroupFactory() *Factory {
+	return NewFactory(&assocGroup{}).
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		})
+}
+
+func TestSubFactoryRoundRobin(t *testing.T) {
+	userFactory := NewFactory(&assocUser{}).
+		SubFactory("Group", newAssocGroupFactory(), RoundRobin(3))
+
+	for i := 0; i < 9; i++ {
+		user := userFactory.MustCreate().(*assocUser)
+		if expected := i%3 + 1; user.Group.ID != expected {
+			t.Errorf("user.Group.ID should be %v, not %v", expected, user.Group.ID)
+		}
+	}
+}
+
+func TestPoolStrategyInvalidSize(t *testing.T) {
+	for name, newStrategy := range map[string]func(int) AssocOption{"RoundRobin": RoundRobin, "RandomPick": RandomPick} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%v(0) should panic", name)
+				}
+			}()
+			newStrategy(0)
+		}()
+	}
+}
+
+func TestSubFactoryRandomPick(t *testing.T) {
+	userFactory := NewFactory(&assocUser{}).
+		SubFactory("Group", newAssocGroupFactory(), RandomPick(5))
+
+	groups := make(map[*assocGroup]bool)
+	for i := 0; i < 100; i++ {
+		groups[userFactory.MustCreate().(*assocUser).Group] = true
+	}
+	if len(groups) > 5 {
+		t.Errorf("the number of distinct groups should not exceed 5, not %v", len(groups))
+	}
+}
+
+func TestSubSliceFactoryReusePerScope(t *testing.T) {
+	userFactory := NewFactory(&assocUser{}).
+		SubSliceFactory("Groups", newAssocGroupFactory(), func() int { return 3 }, ReusePerScope())
+
+	user1 := userFactory.MustCreate().(*assocUser)
+	user2 := userFactory.MustCreate().(*assocUser)
+	for _, group := range user1.Groups {
+		if group != user1.Groups[0] {
+			t.Error("groups in a create call should be the same object")
+		}
+	}
+	if user1.Groups[0] == user2.Groups[0] {
+		t.Error("groups in different create calls should not be the same object")
+	}
+}
+
+type assocTeam struct {
+	ID int
+}
+
+type assocMember struct {
+	Group *assocGroup
+	Team  *assocTeam
+}
+
+func TestSubFactoryReusePerScopeMultiple(t *testing.T) {
+	teamFactory := NewFactory(&assocTeam{})
+	memberFactory := NewFactory(&assocMember{}).
+		SubFactory("Group", newAssocGroupFactory(), ReusePerScope()).
+		SubFactory("Team", teamFactory, ReusePerScope())
+
+	member, err := memberFactory.Create()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := member.(*assocMember); m.Group == nil || m.Team == nil {
+		t.Errorf("each attribute should have its own object, not %+v", m)
+	}
+}
+
+func TestSubFactoryPickFrom(t *testing.T) {
+	groups := []*assocGroup{{ID: 10}, {ID: 20}}
+	userFactory := NewFactory(&assocUser{}).
+		SubFactory("Group", newAssocGroupFactory(), PickFrom(groups))
+
+	for i := 0; i < 10; i++ {
+		user := userFactory.MustCreate().(*assocUser)
+		if user.Group != groups[0] && user.Group != groups[1] {
+			t.Errorf("user.Group should be picked from groups, not %v", user.Group)
+		}
+	}
+}
+
+type cycleUser struct {
+	Group *cycleGroup
+}
+
+type cycleGroup struct {
+	Owner *cycleUser
+}
+
+func TestSubFactoryCycle(t *testing.T) {
+	userFactory := NewFactory(&cycleUser{})
+	groupFactory := NewFactory(&cycleGroup{}).SubFactory("Owner", userFactory)
+	userFactory.SubFactory("Group", groupFactory)
+
+	_, err := userFactory.Create()
+	cerr, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("err should be *CycleError, not %v", err)
+	}
+	if msg := cerr.Error(); msg != "factory: cycle detected: cycleUser -> cycleGroup -> cycleUser" {
+		t.Errorf("unexpected error message: %v", msg)
+	}
+}
+
+func TestSubFactoryCycleWithLimit(t *testing.T) {
+	userFactory := NewFactory(&cycleUser{})
+	groupFactory := NewFactory(&cycleGroup{}).SubFactory("Owner", userFactory)
+	userFactory.SubRecursiveFactory("Group", groupFactory, func() int { return 2 })
+
+	user, err := userFactory.Create()
+	if err != nil {
+		t.Fatalf("a cycle through a recursive sub-factory should be allowed: %v", err)
+	}
+	depth := 0
+	for u := user.(*cycleUser); u.Group != nil; u = u.Group.Owner {
+		depth++
+	}
+	if depth != 2 {
+		t.Errorf("the chain should have 2 groups, not %v", depth)
+	}
+
+	// The attribute which closes the cycle is given, so nothing recurses.
+	userFactory = NewFactory(&cycleUser{})
+	groupFactory = NewFactory(&cycleGroup{}).SubFactory("Owner", userFactory, Elements{{"Group": nil}})
+	userFactory.SubFactory("Group", groupFactory)
+	if _, err := userFactory.Create(); err != nil {
+		t.Errorf("a cycle closed by a given attribute should be allowed: %v", err)
+	}
+}
+
+func TestCreateLimits(t *testing.T) {
+	userFactory := NewFactory(&assocUser{}).
+		SubSliceFactory("Groups", newAssocGroupFactory(), func() int { return 3 })
+
+	defer func(depth, objects int) {
+		MaxDepth, MaxObjects = depth, objects
+	}(MaxDepth, MaxObjects)
+
+	MaxObjects = 3
+	if _, err := userFactory.Create(); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err should be ErrLimitExceeded, not %v", err)
+	}
+	MaxObjects = 4
+	if _, err := userFactory.Create(); err != nil {
+		t.Error(err)
+	}
+
+	MaxObjects, MaxDepth = 0, 0
+	if _, err := userFactory.Create(); err != nil {
+		t.Error(err)
+	}
+	MaxDepth = 1
+	if _, err := userFactory.Create(); err != nil {
+		t.Error(err)
+	}
+	type team struct {
+		Leader *assocUser
+	}
+	teamFactory := NewFactory(&team{}).SubFactory("Leader", userFactory)
+	if _, err := teamFactory.Create(); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("err should be ErrLimitExceeded, not %v", err)
+	}
+}
+
+type treeCategory struct {
+	Name     string
+	Depth    int
+	Children []*treeCategory
+}
+
+type treeCatalog struct {
+	Roots []*treeCategory
+}
+
+func countTreeNodes(categories []*treeCategory) int {
+	n := len(categories)
+	for _, category := range categories {
+		n += countTreeNodes(category.Children)
+	}
+	return n
+}
+
+func TestSubRecursiveSliceFactoryTreeSize(t *testing.T) {
+	categoryFactory := NewFactory(&treeCategory{})
+	categoryFactory.
+		Attr("Depth", func(args Args) (interface{}, error) {
+			return args.Depth(), nil
+		}).
+		SubRecursiveSliceFactory("Children", categoryFactory, nil, func() int { return 3 },
+			TreeSize(func(depth int, args Args) int {
+				return 3 - depth
+			}))
+	catalogFactory := NewFactory(&treeCatalog{}).
+		SubSliceFactory("Roots", categoryFactory, func() int { return 2 })
+
+	catalog := catalogFactory.MustCreate().(*treeCatalog)
+	if len(catalog.Roots) != 2 {
+		t.Fatalf("len(catalog.Roots) should be 2, not %v", len(catalog.Roots))
+	}
+	for _, root := range catalog.Roots {
+		if len(root.Children) != 3 {
+			t.Errorf("len(root.Children) should be 3, not %v", len(root.Children))
+		}
+		for _, child := range root.Children {
+			if len(child.Children) != 2 {
+				t.Errorf("len(child.Children) should be 2, not %v", len(child.Children))
+			}
+			for _, grandchild := range child.Children {
+				if grandchild.Depth != 3 {
+					t.Errorf("grandchild.Depth should be 3, not %v", grandchild.Depth)
+				}
+				if len(grandchild.Children) != 1 {
+					t.Errorf("len(grandchild.Children) should be 1, not %v", len(grandchild.Children))
+				}
+			}
+		}
+	}
+}
+
+func TestSubRecursiveSliceFactoryMaxNodes(t *testing.T) {
+	categoryFactory := NewFactory(&treeCategory{})
+	categoryFactory.
+		SubRecursiveSliceFactory("Children", categoryFactory, func() int { return 4 }, func() int { return 5 }, MaxNodes(10))
+
+	root := categoryFactory.MustCreate().(*treeCategory)
+	if n := countTreeNodes(root.Children); n != 10 {
+		t.Errorf("the number of nodes should be 10, not %v", n)
+	}
+}
+
+func TestSubSliceFactorySizeAndCount(t *testing.T) {
+	type user struct {
+		PostCount int
+		Groups    []*assocGroup
+	}
+	userFactory := NewFactory(&user{PostCount: 2}).
+		SubSliceFactory("Groups", newAssocGroupFactory(), nil, Size(func(args Args) int {
+			return args.Instance().(*user).PostCount
+		}))
+
+	if u := userFactory.MustCreate().(*user); len(u.Groups) != 2 {
+		t.Errorf("len(u.Groups) should be 2, not %v", len(u.Groups))
+	}
+	if u := userFactory.MustCreateWithOption(map[string]interface{}{"PostCount": 4}).(*user); len(u.Groups) != 4 {
+		t.Errorf("len(u.Groups) should be 4, not %v", len(u.Groups))
+	}
+	if u := userFactory.MustCreateWithOption(map[string]interface{}{"Groups": Count(10)}).(*user); len(u.Groups) != 10 {
+		t.Errorf("len(u.Groups) should be 10, not %v", len(u.Groups))
+	}
+	if u := userFactory.MustCreate().(*user); len(u.Groups) != 2 {
+		t.Errorf("Count should not change the factory, but len(u.Groups) is %v", len(u.Groups))
+	}
+}
+
+func TestSubSliceFactoryElements(t *testing.T) {
+	type member struct {
+		Role  string
+		Index int
+	}
+	type team struct {
+		Members []*member
+	}
+
+	memberFactory := NewFactory(&member{Role: "member"}).
+		Trait("owner", map[string]interface{}{"Role": "owner"}).
+		Attr("Index", func(args Args) (interface{}, error) {
+			return args.Index(), nil
+		})
+	teamFactory := NewFactory(&team{}).
+		SubSliceFactory("Members", memberFactory, func() int { return 3 }, Elements{
+			{TraitsAttr: Traits{"owner"}},
+		})
+
+	tm := teamFactory.MustCreate().(*team)
+	for i, m := range tm.Members {
+		expected := "member"
+		if i == 0 {
+			expected = "owner"
+		}
+		if m.Role != expected {
+			t.Errorf("tm.Members[%v].Role should be %v, not %v", i, expected, m.Role)
+		}
+	}
+
+	tm = teamFactory.MustCreateWithOption(map[string]interface{}{
+		"Members": AssocOptions(Count(4), ElementsFunc(func(i int, args Args) map[string]interface{} {
+			if i%2 == 1 {
+				return map[string]interface{}{"Role": "guest"}
+			}
+			return nil
+		})),
+	}).(*team)
+	if len(tm.Members) != 4 {
+		t.Fatalf("len(tm.Members) should be 4, not %v", len(tm.Members))
+	}
+	for i, m := range tm.Members {
+		expected := "member"
+		if i%2 == 1 {
+			expected = "guest"
+		}
+		if m.Role != expected || m.Index != i {
+			t.Errorf("unexpected tm.Members[%v]: %+v", i, m)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// TestingT is the subset of testing.TB used by AssertCoverage.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// AllowUnset excludes the attributes from the coverage check of AssertCoverage.
+// A field can also be excluded by the struct tag `factory:",optional"`.
+func (fa *Factory) AllowUnset(names ...string) *Factory {
+	if fa.allowUnset == nil {
+		fa.allowUnset = make(map[string]bool)
+	}
+	for _, name := range names {
+		fa.allowUnset[fa.attrGens[fa.checkIdx(name)].key] = true
+	}
+	return fa
+}
+
+// UncoveredAttrs returns the attributes which have neither a generator nor a non-zero default value,
+// except for the attributes allowed by AllowUnset or the struct tag. Unexported fields are ignored.
+// For factories created by NewFactoryFunc, the default values are the values set by the constructor,
+// which is called once with a background context.
+// It returns an error if fa is a lazy factory which cannot be resolved, or if the constructor fails.
+func (fa *Factory) UncoveredAttrs() ([]string, error) {
+	fa, err := fa.tryResolve()
+	if err != nil {
+		return nil, err
+	}
+	var constructed reflect.Value
+	if fa.ctor != nil {
+		constructed, err = fa.newInstance(&argsStruct{ctx: context.Background(), fa: fa})
+		if err != nil {
+			return nil, fmt.Errorf("factory: failed to construct %v: %w", fa.ModelType(), err)
+		}
+	}
+	var names []string
+	for i, ag := range fa.attrGens {
+		sf := fa.rt.Field(i)
+		if sf.PkgPath != "" || ag.genFunc != nil || fa.allowUnset[ag.key] || hasTagFlag(sf, TagName, "optional") {
+			continue
+		}
+		if constructed.IsValid() {
+			if !constructed.Field(i).IsZero() {
+				continue
+			}
+		} else if !ag.isNil && ag.value != nil && !reflect.ValueOf(ag.value).IsZero() {
+			continue
+		}
+		names = append(names, ag.key)
+	}
+	return names, nil
+}
+
+// AssertCoverage reports an error to t for each attribute of the factories returned by UncoveredAttrs,
+// and for each factory which cannot be resolved.
+func AssertCoverage(t TestingT, factories ...*Factory) {
+	t.Helper()
+	for _, fa := range factories {
+		names, err := fa.UncoveredAttrs()
+		if err != nil {
+			t.Errorf("%v", err)
+			continue
+		}
+		for _, name := range names {
+			t.Errorf("factory for %v does not populate %v", fa.ModelType(), name)
+		}
+	}
+}
+
+// AssertCoverage checks the coverage of all the registered factories like AssertCoverage.
+func (r *Registry) AssertCoverage(t TestingT) {
+	t.Helper()
+	r.Each(func(name string, fa *Factory) bool {
+		attrs, err := fa.UncoveredAttrs()
+		if err != nil {
+			t.Errorf("factory %v: %v", name, err)
+			return true
+		}
+		for _, attr := range attrs {
+			t.Errorf("factory %v for %v does not populate %v", name, fa.ModelType(), attr)
+		}
+		return true
+	})
+}
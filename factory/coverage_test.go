@@ -0,0 +1,92 @@
+package factory
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertCoverage(t *testing.T) {
+	type User struct {
+		ID        int
+		Name      string `factory:"name"`
+		Location  string
+		Nickname  string `factory:"nick,optional"`
+		Note      string
+		CreatedAt *int
+		Payer     fmt.Stringer
+		internal  string
+	}
+
+	userFactory := NewFactory(&User{Location: "Tokyo"}).
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		})
+
+	if names, err := userFactory.UncoveredAttrs(); err != nil || !reflect.DeepEqual(names, []string{"name", "Note", "CreatedAt", "Payer"}) {
+		t.Errorf("unexpected uncovered attributes: %v, %v", names, err)
+	}
+
+	rt := &recordingT{}
+	AssertCoverage(rt, userFactory.AllowUnset("Note", "Payer"))
+	expected := []string{
+		"factory for *factory.User does not populate name",
+		"factory for *factory.User does not populate CreatedAt",
+	}
+	if !reflect.DeepEqual(rt.errors, expected) {
+		t.Errorf("unexpected errors: %v", rt.errors)
+	}
+
+	registry := NewRegistry()
+	registry.MustRegister("user", userFactory)
+	rt = &recordingT{}
+	registry.AssertCoverage(rt)
+	if len(rt.errors) != 2 || rt.errors[0] != "factory user for *factory.User does not populate name" {
+		t.Errorf("unexpected errors: %v", rt.errors)
+	}
+
+	registry.MustRegister("group", registry.Ref("missing"))
+	rt = &recordingT{}
+	registry.AssertCoverage(rt)
+	if len(rt.errors) != 3 || rt.errors[2] != "factory group: factory: no factory is registered as missing" {
+		t.Errorf("an unresolved factory should be reported: %v", rt.errors)
+	}
+}
+
+func TestUncoveredAttrsWithConstructor(t *testing.T) {
+	type Order struct {
+		ID     int
+		Items  map[string]int
+		Status string
+		Note   string
+	}
+	orderFactory := NewFactoryFunc(func(Args) (*Order, error) {
+		return &Order{Items: map[string]int{}, Status: "pending"}, nil
+	}).SeqInt("ID", func(n int) (interface{}, error) {
+		return n, nil
+	})
+	if names, err := orderFactory.UncoveredAttrs(); err != nil || !reflect.DeepEqual(names, []string{"Note"}) {
+		t.Errorf("only attributes set by neither the constructor nor a generator should be reported: %v, %v", names, err)
+	}
+	if names, err := orderFactory.AllowUnset("Note").UncoveredAttrs(); err != nil || len(names) != 0 {
+		t.Errorf("unexpected uncovered attributes: %v, %v", names, err)
+	}
+
+	failingFactory := NewFactoryFunc(func(Args) (*Order, error) {
+		return nil, errors.New("no database")
+	})
+	if _, err := failingFactory.UncoveredAttrs(); err == nil {
+		t.Error("UncoveredAttrs should fail if the constructor fails")
+	}
+}
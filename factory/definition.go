@@ -0,0 +1,502 @@
+package factory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+Factory definitions can be loaded from JSON files, so that fixtures can be added without writing Go.
+YAML documents can be loaded after converting them to JSON. A file maps factory names to definitions:
+
+	{
+	  "user": {
+	    "model": "User",
+	    "attrs": {
+	      "Location": "Tokyo",
+	      "ID":       {"sequence": ""},
+	      "Email":    {"sequence": "user-%d@example.com"},
+	      "Name":     {"fake": "name"},
+	      "Group":    {"factory": "group"},
+	      "Posts":    {"factory": "post", "size": 3, "traits": ["published"]}
+	    },
+	    "traits": {
+	      "admin": {"Role": "admin"}
+	    }
+	  }
+	}
+
+model is a name registered by RegisterModel. An attribute is one of:
+
+	a JSON value other than an object: a constant value
+	{"value": v}: a constant value
+	{"sequence": format}: a sequence starting at 1, formatted by fmt.Sprintf if format is not empty
+	{"fake": name}: a value generated by the provider registered by RegisterProvider
+	{"factory": name}: an object created by the registered factory, "size" is required for slice attributes
+*/
+
+// DefinitionError reports an invalid factory definition.
+type DefinitionError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Msg)
+}
+
+// RegisterModel registers a model which factory definitions refer to by name.
+// model is used as the model of NewFactory, so it can have default values.
+func (r *Registry) RegisterModel(name string, model interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.models[name]; ok {
+		return fmt.Errorf("factory: duplicate registration of model %v", name)
+	}
+	r.models[name] = model
+	return nil
+}
+
+// RegisterProvider registers a generator which factory definitions refer to by name with "fake".
+func (r *Registry) RegisterProvider(name string, gen func(Args) (interface{}, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.providers[name]; ok {
+		return fmt.Errorf("factory: duplicate registration of provider %v", name)
+	}
+	r.providers[name] = gen
+	return nil
+}
+
+// LoadDefinitions reads factory definitions from a JSON file and registers the factories.
+func (r *Registry) LoadDefinitions(path string) (map[string]*Factory, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.ParseDefinitions(path, data)
+}
+
+// ParseDefinitions parses factory definitions and registers the factories. file is used for error messages.
+func (r *Registry) ParseDefinitions(file string, data []byte) (map[string]*Factory, error) {
+	root, err := parseJSON(file, data)
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != '{' {
+		return nil, root.errorf("factory definitions should be an object")
+	}
+
+	ld := &loader{registry: r}
+	factories := make(map[string]*Factory)
+	for _, def := range root.fields {
+		fa, err := ld.factory(def)
+		if err != nil {
+			return nil, err
+		}
+		factories[def.key] = fa
+	}
+	// sub-factories can refer to factories defined later in the file, so they are checked after all definitions are parsed.
+	for _, ref := range ld.refs {
+		if _, ok := factories[ref.name]; ok {
+			continue
+		}
+		if _, ok := r.Get(ref.name); !ok {
+			return nil, ref.node.errorf("no factory is registered as %v", ref.name)
+		}
+	}
+
+	// the factories are registered all together or not at all, so a fixed file can be loaded again.
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defined := make(map[string]bool)
+	for _, def := range root.fields {
+		if _, ok := r.factories[def.key]; ok || defined[def.key] {
+			return nil, def.value.errorf("factory: duplicate registration of %v", def.key)
+		}
+		defined[def.key] = true
+	}
+	for _, def := range root.fields {
+		r.factories[def.key] = factories[def.key]
+		r.names = append(r.names, def.key)
+	}
+	return factories, nil
+}
+
+// RegisterModel registers a model in DefaultRegistry.
+func RegisterModel(name string, model interface{}) error {
+	return DefaultRegistry.RegisterModel(name, model)
+}
+
+// RegisterProvider registers a generator in DefaultRegistry.
+func RegisterProvider(name string, gen func(Args) (interface{}, error)) error {
+	return DefaultRegistry.RegisterProvider(name, gen)
+}
+
+// LoadDefinitions reads factory definitions from a JSON file and registers the factories in DefaultRegistry.
+func LoadDefinitions(path string) (map[string]*Factory, error) {
+	return DefaultRegistry.LoadDefinitions(path)
+}
+
+type loader struct {
+	registry *Registry
+	refs     []factoryRef
+}
+
+type factoryRef struct {
+	name string
+	node *jsonNode
+}
+
+func (ld *loader) factory(def *jsonField) (*Factory, error) {
+	if def.value.kind != '{' {
+		return nil, def.value.errorf("definition of %v should be an object", def.key)
+	}
+	if err := def.value.checkKeys("model", "attrs", "traits"); err != nil {
+		return nil, err
+	}
+
+	modelNode := def.value.get("model")
+	if modelNode == nil {
+		return nil, def.value.errorf("definition of %v has no model", def.key)
+	}
+	modelName, ok := modelNode.value.(string)
+	if !ok {
+		return nil, modelNode.errorf("model should be a string")
+	}
+	ld.registry.mu.RLock()
+	model, ok := ld.registry.models[modelName]
+	ld.registry.mu.RUnlock()
+	if !ok {
+		return nil, modelNode.errorf("no model is registered as %v", modelName)
+	}
+
+	fa := NewFactory(model)
+	if attrs := def.value.get("attrs"); attrs != nil {
+		if attrs.kind != '{' {
+			return nil, attrs.errorf("attrs should be an object")
+		}
+		for _, attr := range attrs.fields {
+			if err := ld.attr(fa, attr); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if traits := def.value.get("traits"); traits != nil {
+		if traits.kind != '{' {
+			return nil, traits.errorf("traits should be an object")
+		}
+		for _, trait := range traits.fields {
+			opt, err := ld.values(fa, trait.value)
+			if err != nil {
+				return nil, err
+			}
+			fa.Trait(trait.key, opt)
+		}
+	}
+	return fa, nil
+}
+
+func (ld *loader) attr(fa *Factory, attr *jsonField) error {
+	idx, ok := fa.nameIndexMap[attr.key]
+	if !ok {
+		return attr.value.errorf("%v has no attribute %v", fa.modelName(), attr.key)
+	}
+	tp := fa.rt.Field(idx).Type
+	spec := attr.value
+
+	if spec.kind != '{' {
+		return ld.constant(fa, attr.key, tp, spec)
+	}
+	if err := spec.checkKeys("value", "sequence", "fake", "factory", "size", "traits"); err != nil {
+		return err
+	}
+	var kinds []string
+	for _, kind := range []string{"value", "sequence", "fake", "factory"} {
+		if spec.get(kind) != nil {
+			kinds = append(kinds, kind)
+		}
+	}
+	if len(kinds) != 1 {
+		return spec.errorf("attribute %v should have one of value, sequence, fake or factory", attr.key)
+	}
+	if kinds[0] != "factory" && (spec.get("size") != nil || spec.get("traits") != nil) {
+		return spec.errorf("size and traits are only available with factory")
+	}
+
+	switch kinds[0] {
+	case "value":
+		return ld.constant(fa, attr.key, tp, spec.get("value"))
+	case "sequence":
+		return ld.sequence(fa, attr.key, tp, spec.get("sequence"))
+	case "fake":
+		node := spec.get("fake")
+		name, ok := node.value.(string)
+		if !ok {
+			return node.errorf("fake should be a string")
+		}
+		ld.registry.mu.RLock()
+		gen, ok := ld.registry.providers[name]
+		ld.registry.mu.RUnlock()
+		if !ok {
+			return node.errorf("no provider is registered as %v", name)
+		}
+		fa.Attr(attr.key, gen)
+		return nil
+	}
+	return ld.sub(fa, attr.key, tp, spec)
+}
+
+func (ld *loader) constant(fa *Factory, name string, tp reflect.Type, node *jsonNode) error {
+	if _, err := node.decode(tp); err != nil {
+		return err
+	}
+	// decode every time, so objects do not share maps, slices or pointers.
+	fa.Attr(name, func(Args) (interface{}, error) {
+		return node.decode(tp)
+	})
+	return nil
+}
+
+func (ld *loader) sequence(fa *Factory, name string, tp reflect.Type, node *jsonNode) error {
+	format, ok := node.value.(string)
+	if !ok {
+		return node.errorf("sequence should be a format string")
+	}
+	var seq int64
+	if format != "" {
+		if tp.Kind() != reflect.String {
+			return node.errorf("sequence with format requires a string attribute, not %v", tp)
+		}
+		fa.Attr(name, func(Args) (interface{}, error) {
+			n := atomic.AddInt64(&seq, 1)
+			return reflect.ValueOf(fmt.Sprintf(format, n)).Convert(tp).Interface(), nil
+		})
+		return nil
+	}
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.String:
+	default:
+		return node.errorf("sequence requires an integer or string attribute, not %v", tp)
+	}
+	fa.Attr(name, func(Args) (interface{}, error) {
+		n := atomic.AddInt64(&seq, 1)
+		if tp.Kind() == reflect.String {
+			return reflect.ValueOf(fmt.Sprint(n)).Convert(tp).Interface(), nil
+		}
+		return reflect.ValueOf(n).Convert(tp).Interface(), nil
+	})
+	return nil
+}
+
+func (ld *loader) sub(fa *Factory, name string, tp reflect.Type, spec *jsonNode) error {
+	node := spec.get("factory")
+	ref, ok := node.value.(string)
+	if !ok {
+		return node.errorf("factory should be a string")
+	}
+	ld.refs = append(ld.refs, factoryRef{name: ref, node: node})
+	sub := ld.registry.Ref(ref)
+
+	var opts []AssocOption
+	if traits := spec.get("traits"); traits != nil {
+		var names Traits
+		if err := traits.decodeTo(&names); err != nil {
+			return err
+		}
+		opts = append(opts, ElementsFunc(func(int, Args) map[string]interface{} {
+			return map[string]interface{}{TraitsAttr: names}
+		}))
+	}
+
+	sizeNode := spec.get("size")
+	if tp.Kind() != reflect.Slice {
+		if sizeNode != nil {
+			return sizeNode.errorf("size requires a slice attribute, not %v", tp)
+		}
+		fa.SubFactory(name, sub, opts...)
+		return nil
+	}
+	if sizeNode == nil {
+		return spec.errorf("size is required for slice attribute %v", name)
+	}
+	var size int
+	if err := sizeNode.decodeTo(&size); err != nil {
+		return err
+	}
+	fa.SubSliceFactory(name, sub, func() int { return size }, opts...)
+	return nil
+}
+
+// values decodes an object into attribute values of fa.
+func (ld *loader) values(fa *Factory, node *jsonNode) (map[string]interface{}, error) {
+	if node.kind != '{' {
+		return nil, node.errorf("attribute values should be an object")
+	}
+	opt := make(map[string]interface{})
+	for _, field := range node.fields {
+		idx, ok := fa.nameIndexMap[field.key]
+		if !ok {
+			return nil, field.value.errorf("%v has no attribute %v", fa.modelName(), field.key)
+		}
+		v, err := field.value.decode(fa.rt.Field(idx).Type)
+		if err != nil {
+			return nil, err
+		}
+		opt[field.key] = v
+	}
+	return opt, nil
+}
+
+// jsonNode is a parsed JSON value which remembers its position.
+type jsonNode struct {
+	file   string
+	line   int
+	raw    json.RawMessage
+	kind   byte        // '{', '[' or 0 for scalars
+	value  interface{} // string, json.Number, bool or nil for scalars
+	fields []*jsonField
+	items  []*jsonNode
+}
+
+type jsonField struct {
+	key   string
+	value *jsonNode
+}
+
+func (n *jsonNode) errorf(format string, args ...interface{}) error {
+	return &DefinitionError{File: n.file, Line: n.line, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (n *jsonNode) get(key string) *jsonNode {
+	for _, field := range n.fields {
+		if field.key == key {
+			return field.value
+		}
+	}
+	return nil
+}
+
+func (n *jsonNode) checkKeys(keys ...string) error {
+	for _, field := range n.fields {
+		found := false
+		for _, key := range keys {
+			if field.key == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return field.value.errorf("unknown key %v, expected one of %v", field.key, strings.Join(keys, ", "))
+		}
+	}
+	return nil
+}
+
+func (n *jsonNode) decode(tp reflect.Type) (interface{}, error) {
+	ptr := reflect.New(tp)
+	if err := n.decodeTo(ptr.Interface()); err != nil {
+		return nil, err
+	}
+	return ptr.Elem().Interface(), nil
+}
+
+func (n *jsonNode) decodeTo(v interface{}) error {
+	if err := json.Unmarshal(n.raw, v); err != nil {
+		return n.errorf("%v", err)
+	}
+	return nil
+}
+
+func parseJSON(file string, data []byte) (*jsonNode, error) {
+	p := &jsonParser{file: file, data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := p.dec.Token(); err == nil {
+		return nil, &DefinitionError{File: file, Line: p.line(int(p.dec.InputOffset())), Msg: "unexpected data after the top-level value"}
+	}
+	return root, nil
+}
+
+type jsonParser struct {
+	file string
+	data []byte
+	dec  *json.Decoder
+}
+
+func (p *jsonParser) parse() (*jsonNode, error) {
+	start := p.skip(int(p.dec.InputOffset()))
+	node := &jsonNode{file: p.file, line: p.line(start)}
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, p.error(err)
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		node.kind = '{'
+		for p.dec.More() {
+			key, err := p.dec.Token()
+			if err != nil {
+				return nil, p.error(err)
+			}
+			value, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			node.fields = append(node.fields, &jsonField{key: key.(string), value: value})
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, p.error(err)
+		}
+	case json.Delim('['):
+		node.kind = '['
+		for p.dec.More() {
+			item, err := p.parse()
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		if _, err := p.dec.Token(); err != nil {
+			return nil, p.error(err)
+		}
+	default:
+		node.value = tok
+	}
+	node.raw = p.data[start:p.dec.InputOffset()]
+	return node, nil
+}
+
+// skip returns the offset of the next value, skipping white spaces and separators.
+func (p *jsonParser) skip(offset int) int {
+	for offset < len(p.data) && strings.IndexByte(" \t\r\n,:", p.data[offset]) >= 0 {
+		offset++
+	}
+	return offset
+}
+
+func (p *jsonParser) line(offset int) int {
+	return bytes.Count(p.data[:offset], []byte("\n")) + 1
+}
+
+func (p *jsonParser) error(err error) error {
+	offset := int(p.dec.InputOffset())
+	if serr, ok := err.(*json.SyntaxError); ok {
+		offset = int(serr.Offset)
+	}
+	if offset > len(p.data) {
+		offset = len(p.data)
+	}
+	return &DefinitionError{File: p.file, Line: p.line(offset), Msg: err.Error()}
+}
@@ -0,0 +1,142 @@
+package factory
+
+import (
+	"strings"
+	"testing"
+)
+
+type defGroup struct {
+	Name string
+}
+
+type defPost struct {
+	Title     string
+	Published bool
+}
+
+type defUser struct {
+	ID       int
+	Email    string
+	Name     string
+	Location string
+	Role     string
+	Tags     []string
+	Group    *defGroup
+	Posts    []*defPost
+}
+
+func newDefinitionRegistry(t *testing.T) *Registry {
+	registry := NewRegistry()
+	for name, model := range map[string]interface{}{
+		"User":  &defUser{Role: "member"},
+		"Group": &defGroup{},
+		"Post":  &defPost{},
+	} {
+		if err := registry.RegisterModel(name, model); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := registry.RegisterProvider("name", func(Args) (interface{}, error) {
+		return "bluele", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return registry
+}
+
+func TestParseDefinitions(t *testing.T) {
+	registry := newDefinitionRegistry(t)
+	factories, err := registry.ParseDefinitions("factories.json", []byte(`{
+  "user": {
+    "model": "User",
+    "attrs": {
+      "ID": {"sequence": ""},
+      "Email": {"sequence": "user-%d@example.com"},
+      "Name": {"fake": "name"},
+      "Location": "Tokyo",
+      "Tags": {"value": ["a", "b"]},
+      "Group": {"factory": "group"},
+      "Posts": {"factory": "post", "size": 2, "traits": ["published"]}
+    },
+    "traits": {
+      "admin": {"Role": "admin"}
+    }
+  },
+  "group": {"model": "Group", "attrs": {"Name": "admins"}},
+  "post": {
+    "model": "Post",
+    "attrs": {"Title": {"sequence": "post-%d"}},
+    "traits": {"published": {"Published": true}}
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fa, _ := registry.Get("user"); fa != factories["user"] {
+		t.Error("user factory should be registered")
+	}
+
+	user := factories["user"].MustCreateWithOption(map[string]interface{}{TraitsAttr: Traits{"admin"}}).(*defUser)
+	if user.ID != 1 || user.Email != "user-1@example.com" || user.Name != "bluele" || user.Location != "Tokyo" || user.Role != "admin" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+	if len(user.Tags) != 2 || user.Tags[1] != "b" {
+		t.Errorf("unexpected user.Tags: %v", user.Tags)
+	}
+	if user.Group == nil || user.Group.Name != "admins" {
+		t.Errorf("unexpected user.Group: %+v", user.Group)
+	}
+	if len(user.Posts) != 2 || user.Posts[1].Title != "post-2" || !user.Posts[1].Published {
+		t.Errorf("unexpected user.Posts: %+v", user.Posts)
+	}
+
+	user = factories["user"].MustCreate().(*defUser)
+	if user.ID != 2 || user.Role != "member" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+}
+
+func TestParseDefinitionsErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		err  string
+	}{
+		{`{"user": {"model": "Unknown"}}`, "defs.json:1: no model is registered as Unknown"},
+		{"{\n  \"user\": {\n    \"model\": \"User\",\n    \"attrs\": {\"Unknown\": 1}\n  }\n}", "defs.json:4: defUser has no attribute Unknown"},
+		{"{\n  \"user\": {\n    \"model\": \"User\",\n    \"attrs\": {\n      \"ID\": \"one\"\n    }\n  }\n}", "defs.json:5: json: cannot unmarshal string"},
+		{"{\"user\": {\"model\": \"User\",\n\"attrs\": {\"Group\": {\"factory\": \"unknown\"}}}}", "defs.json:2: no factory is registered as unknown"},
+		{`{"user": {"model": "User", "attrs": {"Posts": {"factory": "user"}}}}`, "size is required"},
+		{`{"user": {"model": "User", "attrs": {"ID": {"sequence": "", "fake": "name"}}}}`, "should have one of"},
+		{`{"user": {"model": "User", "attrs": {"Name": {"fake": "unknown"}}}}`, "no provider is registered as unknown"},
+		{"{\n\"user\": {\"model\": \"User\",,}}", "defs.json:2: invalid character"},
+	} {
+		_, err := newDefinitionRegistry(t).ParseDefinitions("defs.json", []byte(tc.data))
+		if err == nil {
+			t.Errorf("%v should cause an error", tc.data)
+		} else if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("error of %v should contain %q, not %q", tc.data, tc.err, err)
+		}
+	}
+}
+
+func TestParseDefinitionsAtomic(t *testing.T) {
+	registry := newDefinitionRegistry(t)
+	broken := `{"group": {"model": "Group"}, "user": {"model": "User", "attrs": {"Group": {"factory": "team"}}}}`
+	if _, err := registry.ParseDefinitions("defs.json", []byte(broken)); err == nil {
+		t.Fatal("an unknown factory should cause an error")
+	}
+	if names := registry.Names(); len(names) != 0 {
+		t.Errorf("no factory should be registered after an error, not %v", names)
+	}
+
+	fixed := strings.Replace(broken, `"team"`, `"group"`, 1)
+	if _, err := registry.ParseDefinitions("defs.json", []byte(fixed)); err != nil {
+		t.Fatalf("the fixed definitions should be loaded: %v", err)
+	}
+	if _, err := registry.ParseDefinitions("defs.json", []byte(`{"post": {"model": "Post"}, "user": {"model": "User"}}`)); err == nil {
+		t.Error("a duplicate name should cause an error")
+	}
+	if _, ok := registry.Get("post"); ok {
+		t.Error("post should not be registered when user is a duplicate")
+	}
+}
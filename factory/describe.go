@@ -0,0 +1,115 @@
+package factory
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// GeneratorKind is the kind of generator of an attribute.
+type GeneratorKind string
+
+const (
+	KindDefault           GeneratorKind = "default" // the value of the model given to NewFactory
+	KindAttr              GeneratorKind = "attr"
+	KindSeq               GeneratorKind = "seq"
+	KindSubFactory        GeneratorKind = "sub"
+	KindSubSlice          GeneratorKind = "sub-slice"
+	KindSubMap            GeneratorKind = "sub-map"
+	KindSubRecursive      GeneratorKind = "sub-recursive"
+	KindSubRecursiveSlice GeneratorKind = "sub-recursive-slice"
+	KindSubPoly           GeneratorKind = "sub-poly"
+	KindSubPolySlice      GeneratorKind = "sub-poly-slice"
+	KindBackRef           GeneratorKind = "backref"
+	KindBackRefKey        GeneratorKind = "backref-key"
+)
+
+// Description describes what a factory generates.
+type Description struct {
+	Model  reflect.Type // e.g. *User
+	Attrs  []AttrDescription
+	Traits []string // sorted
+	Hooks  []string // e.g. "Validate", "OnCreate"
+}
+
+// AttrDescription describes the generator of an attribute.
+type AttrDescription struct {
+	Name  string // attribute name, which can be changed by the struct tag
+	Field string // Go field name
+	Type  reflect.Type
+	Kind  GeneratorKind
+	// Default is the value of the model for KindDefault, or nil.
+	Default interface{}
+	// Sub is the model type created by the sub-factory for sub-factory kinds, or nil.
+	Sub reflect.Type
+	// Limit is the depth limit of recursive kinds, or 0.
+	Limit int
+}
+
+// Describe returns the description of the factory.
+// The depth limit of recursive sub-factories is obtained by calling `getLimit` once.
+func (fa *Factory) Describe() *Description {
+	fa = fa.resolve()
+	desc := &Description{Model: fa.ModelType()}
+	for i, ag := range fa.attrGens {
+		ad := AttrDescription{
+			Name:  ag.key,
+			Field: fa.rt.Field(i).Name,
+			Type:  fa.rt.Field(i).Type,
+			Kind:  ag.kind,
+		}
+		if ag.genFunc == nil {
+			ad.Kind = KindDefault
+			ad.Default = ag.value
+		}
+		if ag.sub != nil {
+			ad.Sub = ag.sub.ModelType()
+		}
+		if ag.getLimit != nil {
+			ad.Limit = ag.getLimit()
+		}
+		desc.Attrs = append(desc.Attrs, ad)
+	}
+	for name := range fa.traits {
+		desc.Traits = append(desc.Traits, name)
+	}
+	sort.Strings(desc.Traits)
+	if len(fa.validators) > 0 || fa.validateModel {
+		desc.Hooks = append(desc.Hooks, "Validate")
+	}
+	if fa.onCreate != nil {
+		desc.Hooks = append(desc.Hooks, "OnCreate")
+	}
+	return desc
+}
+
+// String returns a human readable description.
+func (desc *Description) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%v\n", desc.Model)
+	for _, ad := range desc.Attrs {
+		fmt.Fprintf(&b, "  %v", ad.Name)
+		if ad.Field != ad.Name {
+			fmt.Fprintf(&b, " (%v)", ad.Field)
+		}
+		fmt.Fprintf(&b, " %v: %v", ad.Type, ad.Kind)
+		switch {
+		case ad.Kind == KindDefault:
+			fmt.Fprintf(&b, " %#v", ad.Default)
+		case ad.Sub != nil:
+			fmt.Fprintf(&b, " %v", ad.Sub)
+		}
+		if ad.Limit != 0 {
+			fmt.Fprintf(&b, " limit=%v", ad.Limit)
+		}
+		b.WriteString("\n")
+	}
+	if len(desc.Traits) > 0 {
+		fmt.Fprintf(&b, "  traits: %v\n", strings.Join(desc.Traits, ", "))
+	}
+	if len(desc.Hooks) > 0 {
+		fmt.Fprintf(&b, "  hooks: %v\n", strings.Join(desc.Hooks, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,58 @@
+package factory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFactoryDescribe(t *testing.T) {
+	type Group struct {
+		ID int
+	}
+	type User struct {
+		ID       int
+		Name     string `factory:"name"`
+		Location string
+		Group    *Group
+		Groups   []*Group
+		Friend   *User
+	}
+
+	groupFactory := NewFactory(&Group{})
+	userFactory := NewFactory(&User{Location: "Tokyo"})
+	userFactory.
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		}).
+		Attr("name", func(args Args) (interface{}, error) {
+			return "bluele", nil
+		}).
+		SubFactory("Group", groupFactory).
+		SubSliceFactory("Groups", groupFactory, func() int { return 2 }).
+		SubRecursiveFactory("Friend", userFactory, func() int { return 3 }).
+		Trait("tokyo", map[string]interface{}{"Location": "Tokyo"}).
+		OnCreate(func(Args) error { return nil })
+
+	desc := userFactory.Describe()
+	if desc.Model != reflect.TypeOf(&User{}) {
+		t.Errorf("desc.Model should be *User, not %v", desc.Model)
+	}
+	expected := []AttrDescription{
+		{Name: "ID", Field: "ID", Type: reflect.TypeOf(0), Kind: KindSeq},
+		{Name: "name", Field: "Name", Type: reflect.TypeOf(""), Kind: KindAttr},
+		{Name: "Location", Field: "Location", Type: reflect.TypeOf(""), Kind: KindDefault, Default: "Tokyo"},
+		{Name: "Group", Field: "Group", Type: reflect.TypeOf(&Group{}), Kind: KindSubFactory, Sub: reflect.TypeOf(&Group{})},
+		{Name: "Groups", Field: "Groups", Type: reflect.TypeOf([]*Group{}), Kind: KindSubSlice, Sub: reflect.TypeOf(&Group{})},
+		{Name: "Friend", Field: "Friend", Type: reflect.TypeOf(&User{}), Kind: KindSubRecursive, Sub: reflect.TypeOf(&User{}), Limit: 3},
+	}
+	if !reflect.DeepEqual(desc.Attrs, expected) {
+		t.Errorf("unexpected desc.Attrs:\n%v", desc)
+	}
+	if !reflect.DeepEqual(desc.Traits, []string{"tokyo"}) || !reflect.DeepEqual(desc.Hooks, []string{"OnCreate"}) {
+		t.Errorf("unexpected traits and hooks:\n%v", desc)
+	}
+	if s := desc.String(); !strings.Contains(s, "  name (Name) string: attr\n") {
+		t.Errorf("unexpected desc.String():\n%v", s)
+	}
+}
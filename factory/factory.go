@@ -3,14 +3,22 @@ package factory
 import (
 	"context"
 	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var (
 	TagName    = "factory"
 	emptyValue = reflect.Value{}
+
+	// MaxDepth limits the nesting depth of objects created in a single create call. 0 means no limit.
+	MaxDepth = 0
+	// MaxObjects limits the number of objects created in a single create call. 0 means no limit.
+	MaxObjects = 0
 )
 
 type Factory struct {
@@ -22,12 +30,36 @@ type Factory struct {
 	nameIndexMap map[string]int // pair for attribute name and field index.
 	isPtr        bool
 	onCreate     func(Args) error
+	traits       map[string]map[string]interface{}
+	allowUnset   map[string]bool
+	uniques      []*uniqueConstraint
+	ctor         func(Args) (reflect.Value, error)
+	validators   []func(Args) error
+	// validateModel is whether to call the Validate method of the model.
+	validateModel    bool
+	validateAttempts int
+
+	stats     factoryStats
+	statsOnce sync.Once
+
+	lazy     func() (*Factory, error)
+	lazyMu   sync.Mutex
+	resolved *Factory
 }
 
 type Args interface {
 	Instance() interface{}
 	Parent() Args
 	Context() context.Context
+	Depth() int
+	Index() int
+	Path() string
+	Factory() *Factory
+	Options() map[string]interface{}
+	Root() Args
+	Ancestor(match func(Args) bool) Args
+	AncestorOf(model interface{}) Args
+	AncestorFrom(fa *Factory) Args
 	pipeline(int) *pipeline
 }
 
@@ -35,10 +67,22 @@ type argsStruct struct {
 	ctx context.Context
 	rv  *reflect.Value
 	pl  *pipeline
+	fa  *Factory
+	opt map[string]interface{}
+	// subTime is the time in nanoseconds spent by sub-factories to create the attributes of the object.
+	subTime int64
+	// reserved releases the unique values recorded for the object.
+	reserved []func()
+	// base is a copy of the object before generation, if its attributes can be regenerated.
+	base reflect.Value
 }
 
 // Instance returns a object to which the generator declared just before is applied
 func (args *argsStruct) Instance() interface{} {
+	if args.rv == nil {
+		// the object is being constructed by the constructor given to NewFactoryFunc
+		return nil
+	}
 	return args.rv.Interface()
 }
 
@@ -50,9 +94,78 @@ func (args *argsStruct) Parent() Args {
 	return args.pl.parent
 }
 
+// Depth returns the nesting depth of the object, 0 for an object created directly by Create methods
+func (args *argsStruct) Depth() int {
+	if args.pl == nil {
+		return 0
+	}
+	return args.pl.depth
+}
+
+// Index returns the index of the object in a slice or map of its parent, or -1 if it is not an element of them
+func (args *argsStruct) Index() int {
+	if args.pl == nil {
+		return -1
+	}
+	return args.pl.index
+}
+
+// Path returns the attribute path from the root object, e.g. "Group.Users[1]"
+func (args *argsStruct) Path() string {
+	if args.pl == nil || args.pl.path == "" {
+		return args.fa.modelName()
+	}
+	return args.pl.path
+}
+
+// Factory returns the factory which creates the object
+func (args *argsStruct) Factory() *Factory {
+	return args.fa
+}
+
+// Options returns the attribute values specified for the object. The returned map should not be modified.
+func (args *argsStruct) Options() map[string]interface{} {
+	return args.opt
+}
+
+// Root returns the argument of the root object, or itself if it has no parent
+func (args *argsStruct) Root() Args {
+	var root Args = args
+	for parent := root.Parent(); parent != nil; parent = parent.Parent() {
+		root = parent
+	}
+	return root
+}
+
+// Ancestor returns the argument of the nearest ancestor which satisfies match, or nil if no ancestor satisfies it
+func (args *argsStruct) Ancestor(match func(Args) bool) Args {
+	for parent := args.Parent(); parent != nil; parent = parent.Parent() {
+		if match(parent) {
+			return parent
+		}
+	}
+	return nil
+}
+
+// AncestorOf returns the argument of the nearest ancestor whose object has the same type as model
+func (args *argsStruct) AncestorOf(model interface{}) Args {
+	tp := reflect.TypeOf(model)
+	return args.Ancestor(func(parent Args) bool {
+		return reflect.TypeOf(parent.Instance()) == tp
+	})
+}
+
+// AncestorFrom returns the argument of the nearest ancestor created by fa
+func (args *argsStruct) AncestorFrom(fa *Factory) Args {
+	fa = fa.resolve()
+	return args.Ancestor(func(parent Args) bool {
+		return parent.Factory() == fa
+	})
+}
+
 func (args *argsStruct) pipeline(num int) *pipeline {
 	if args.pl == nil {
-		return newPipeline(num)
+		args.pl = newPipeline(num)
 	}
 	return args.pl
 }
@@ -73,6 +186,9 @@ func (st *Stacks) Size(idx int) int64 {
 
 // Set method is not goroutine safe.
 func (st *Stacks) Set(idx, val int) {
+	for len(*st) <= idx {
+		*st = append(*st, nil)
+	}
 	var ini int64 = 0
 	(*st)[idx] = &ini
 	atomic.StoreInt64((*st)[idx], int64(val))
@@ -92,21 +208,36 @@ func (st *Stacks) Next(idx int) bool {
 }
 
 func (st *Stacks) Has(idx int) bool {
-	return (*st)[idx] != nil
+	return idx < len(*st) && (*st)[idx] != nil
 }
 
 type pipeline struct {
 	stacks Stacks
 	parent Args
+	scope  *scope
+	// budgets are shared by all objects in a tree created by SubRecursiveSliceFactory.
+	budgets map[int]*budget
+	depth   int
+	index   int
+	path    string
+	// assoc is the association which creates the object, or nil.
+	assoc *association
+	// bounded is whether the object is created by a recursive sub-factory, whose depth is limited.
+	bounded bool
 }
 
 func newPipeline(size int) *pipeline {
-	return &pipeline{stacks: make(Stacks, size)}
+	return &pipeline{stacks: make(Stacks, size), scope: newScope(), index: -1}
 }
 
 func (pl *pipeline) Next(args Args) *pipeline {
 	npl := &pipeline{}
 	npl.parent = args
+	npl.scope = pl.scope
+	npl.budgets = pl.budgets
+	npl.depth = args.Depth() + 1
+	npl.index = -1
+	npl.path = args.Path()
 	npl.stacks = make(Stacks, len(pl.stacks))
 	for i, sptr := range pl.stacks {
 		if sptr != nil {
@@ -117,6 +248,42 @@ func (pl *pipeline) Next(args Args) *pipeline {
 	return npl
 }
 
+func (pl *pipeline) budget(idx int) *budget {
+	return pl.budgets[idx]
+}
+
+// setBudget starts a new budget for the tree whose root is created with this pipeline.
+func (pl *pipeline) setBudget(idx, size int) {
+	budgets := make(map[int]*budget, len(pl.budgets)+1)
+	for i, b := range pl.budgets {
+		budgets[i] = b
+	}
+	budgets[idx] = &budget{left: int64(size)}
+	pl.budgets = budgets
+}
+
+// at sets the attribute name and the element index of the object created with this pipeline.
+func (pl *pipeline) at(name string, index int) *pipeline {
+	pl.path += "." + name
+	if index >= 0 {
+		pl.path += "[" + strconv.Itoa(index) + "]"
+	}
+	pl.index = index
+	return pl
+}
+
+// from records the association which creates the object with this pipeline.
+func (pl *pipeline) from(as *association) *pipeline {
+	pl.assoc = as
+	return pl
+}
+
+// bound marks the object created with this pipeline as created by a recursive sub-factory.
+func (pl *pipeline) bound() *pipeline {
+	pl.bounded = true
+	return pl
+}
+
 // NewFactory returns a new factory for specified model class
 // Each generator is applied in the order in which they are declared
 func NewFactory(model interface{}) *Factory {
@@ -128,11 +295,61 @@ func NewFactory(model interface{}) *Factory {
 	return fa
 }
 
+var argsType = reflect.TypeOf((*Args)(nil)).Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// NewFactoryFunc returns a new factory whose objects are obtained from ctor instead of a zero value,
+// for models which require a constructor. ctor should be a function like `func(factory.Args) (*Order, error)`.
+// Generators and attribute values are applied to the constructed object, and attributes without generators are left as constructed.
+func NewFactoryFunc(ctor interface{}) *Factory {
+	ct := reflect.TypeOf(ctor)
+	if ct == nil || ct.Kind() != reflect.Func || ct.NumIn() != 1 || ct.In(0) != argsType || ct.NumOut() != 2 || ct.Out(1) != errorType {
+		panic(fmt.Sprintf("factory: constructor should be func(factory.Args) (T, error), not %v", ct))
+	}
+	mt := ct.Out(0)
+	var model interface{}
+	switch {
+	case mt.Kind() == reflect.Struct:
+		model = reflect.Zero(mt).Interface()
+	case mt.Kind() == reflect.Ptr && mt.Elem().Kind() == reflect.Struct:
+		model = reflect.New(mt.Elem()).Interface()
+	default:
+		panic(fmt.Sprintf("factory: constructor should return a struct or a pointer to struct, not %v", mt))
+	}
+
+	fa := NewFactory(model)
+	cv := reflect.ValueOf(ctor)
+	fa.ctor = func(args Args) (reflect.Value, error) {
+		out := cv.Call([]reflect.Value{reflect.ValueOf(&args).Elem()})
+		if err, _ := out[1].Interface().(error); err != nil {
+			return emptyValue, err
+		}
+		v := out[0]
+		if !fa.isPtr {
+			inst := reflect.New(fa.rt).Elem()
+			inst.Set(v)
+			return inst, nil
+		}
+		if v.IsNil() {
+			return emptyValue, fmt.Errorf("factory: constructor of %v returned nil", mt)
+		}
+		return v.Elem(), nil
+	}
+	return fa
+}
+
 type attrGenerator struct {
-	genFunc func(Args) (interface{}, error)
-	key     string
-	value   interface{}
-	isNil   bool
+	genFunc  func(Args) (interface{}, error)
+	key      string
+	value    interface{}
+	isNil    bool
+	assoc    *association
+	assocGen func(Args, *association) (interface{}, error)
+	kind     GeneratorKind
+	sub      *Factory
+	getLimit func() int
+	// nullable is the probability that the attribute is left as the zero value.
+	nullable float64
 }
 
 func (fa *Factory) init() {
@@ -173,106 +390,157 @@ func (fa *Factory) modelName() string {
 	return fa.rt.Name()
 }
 
+// ModelType returns the type of the model given to NewFactory, e.g. *User.
+func (fa *Factory) ModelType() reflect.Type {
+	return reflect.TypeOf(fa.resolve().model)
+}
+
 func (fa *Factory) Attr(name string, gen func(Args) (interface{}, error)) *Factory {
 	idx := fa.checkIdx(name)
-	fa.attrGens[idx].genFunc = gen
+	fa.setGen(idx, KindAttr, gen)
 	return fa
 }
 
 func (fa *Factory) SeqInt(name string, gen func(int) (interface{}, error)) *Factory {
 	idx := fa.checkIdx(name)
 	var seq int64 = 0
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	fa.setGen(idx, KindSeq, func(args Args) (interface{}, error) {
 		new := atomic.AddInt64(&seq, 1)
 		return gen(int(new))
-	}
+	})
 	return fa
 }
 
 func (fa *Factory) SeqInt64(name string, gen func(int64) (interface{}, error)) *Factory {
 	idx := fa.checkIdx(name)
 	var seq int64 = 0
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	fa.setGen(idx, KindSeq, func(args Args) (interface{}, error) {
 		new := atomic.AddInt64(&seq, 1)
 		return gen(new)
-	}
+	})
 	return fa
 }
 
 func (fa *Factory) SeqString(name string, gen func(string) (interface{}, error)) *Factory {
 	idx := fa.checkIdx(name)
 	var seq int64 = 0
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	fa.setGen(idx, KindSeq, func(args Args) (interface{}, error) {
 		new := atomic.AddInt64(&seq, 1)
 		return gen(strconv.FormatInt(new, 10))
-	}
+	})
 	return fa
 }
 
-func (fa *Factory) SubFactory(name string, sub *Factory) *Factory {
+// SubFactory fills an attribute with an object created by `sub`.
+// opts can change how the object is obtained, e.g. ReusePerScope or RoundRobin.
+func (fa *Factory) SubFactory(name string, sub *Factory, opts ...AssocOption) *Factory {
 	idx := fa.checkIdx(name)
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	fa.setAssoc(idx, KindSubFactory, newAssociation(name, sub, opts), func(args Args, as *association) (interface{}, error) {
 		pipeline := args.pipeline(fa.numField)
-		ret, err := sub.create(args.Context(), nil, pipeline.Next(args))
+		ret, err := as.get(args, pipeline, -1)
 		if err != nil {
 			return nil, err
 		}
 		return ret, nil
-	}
+	})
 	return fa
 }
 
-func (fa *Factory) SubSliceFactory(name string, sub *Factory, getSize func() int) *Factory {
+// SubSliceFactory fills a slice attribute with `getSize()` objects created by `sub`.
+// opts can change how each object is obtained, e.g. ReusePerScope or RoundRobin, and the size with Size or Count.
+func (fa *Factory) SubSliceFactory(name string, sub *Factory, getSize func() int, opts ...AssocOption) *Factory {
 	idx := fa.checkIdx(name)
 	tp := fa.rt.Field(idx).Type
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
-		size := getSize()
+	fa.setAssoc(idx, KindSubSlice, newAssociation(name, sub, opts), func(args Args, as *association) (interface{}, error) {
+		size := as.size(args, getSize)
 		pipeline := args.pipeline(fa.numField)
 		sv := reflect.MakeSlice(tp, size, size)
 		for i := 0; i < size; i++ {
-			ret, err := sub.create(args.Context(), nil, pipeline.Next(args))
+			ret, err := as.get(args, pipeline, i)
 			if err != nil {
 				return nil, err
 			}
 			sv.Index(i).Set(reflect.ValueOf(ret))
 		}
 		return sv.Interface(), nil
-	}
+	})
+	return fa
+}
+
+// SubMapFactory fills a map attribute with `getSize()` objects created by `sub`.
+// getKey is called for each created object; its Args refers to the child object and its parent.
+// opts are applied in the same way as SubSliceFactory.
+func (fa *Factory) SubMapFactory(name string, sub *Factory, getSize func() int, getKey func(Args) (interface{}, error), opts ...AssocOption) *Factory {
+	idx := fa.checkIdx(name)
+	tp := fa.rt.Field(idx).Type
+	fa.setAssoc(idx, KindSubMap, newAssociation(name, sub, opts), func(args Args, as *association) (interface{}, error) {
+		size := as.size(args, getSize)
+		pipeline := args.pipeline(fa.numField)
+		mv := reflect.MakeMapWithSize(tp, size)
+		for i := 0; i < size; i++ {
+			ret, err := as.get(args, pipeline, i)
+			if err != nil {
+				return nil, err
+			}
+			rv := reflect.ValueOf(ret)
+			key, err := getKey(&argsStruct{ctx: args.Context(), rv: &rv, pl: pipeline.Next(args).at(name, i), fa: as.sub.resolve()})
+			if err != nil {
+				return nil, err
+			}
+			kv := reflect.ValueOf(key)
+			if mv.MapIndex(kv).IsValid() {
+				return nil, fmt.Errorf("duplicate key %v for attribute %v", key, name)
+			}
+			mv.SetMapIndex(kv, rv)
+		}
+		return mv.Interface(), nil
+	})
 	return fa
 }
 
 func (fa *Factory) SubRecursiveFactory(name string, sub *Factory, getLimit func() int) *Factory {
 	idx := fa.checkIdx(name)
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	ag := fa.setGen(idx, KindSubRecursive, func(args Args) (interface{}, error) {
 		pl := args.pipeline(fa.numField)
 		if !pl.stacks.Has(idx) {
 			pl.stacks.Set(idx, getLimit())
 		}
 		if pl.stacks.Next(idx) {
-			ret, err := sub.create(args.Context(), nil, pl.Next(args))
+			ret, err := sub.create(args.Context(), nil, pl.Next(args).at(name, -1).bound())
 			if err != nil {
 				return nil, err
 			}
 			return ret, nil
 		}
 		return nil, nil
-	}
+	})
+	ag.sub = sub
+	ag.getLimit = getLimit
 	return fa
 }
 
-func (fa *Factory) SubRecursiveSliceFactory(name string, sub *Factory, getSize, getLimit func() int) *Factory {
+// SubRecursiveSliceFactory fills a slice attribute with `getSize()` objects created by `sub` recursively
+// until the depth reaches `getLimit()`.
+// opts can change the size of each level with TreeSize and limit the number of objects in the tree with MaxNodes.
+func (fa *Factory) SubRecursiveSliceFactory(name string, sub *Factory, getSize, getLimit func() int, opts ...AssocOption) *Factory {
 	idx := fa.checkIdx(name)
 	tp := fa.rt.Field(idx).Type
-	fa.attrGens[idx].genFunc = func(args Args) (interface{}, error) {
+	ag := fa.setAssoc(idx, KindSubRecursiveSlice, newAssociation(name, sub, opts), func(args Args, as *association) (interface{}, error) {
 		pl := args.pipeline(fa.numField)
 		if !pl.stacks.Has(idx) {
 			pl.stacks.Set(idx, getLimit())
+			if as.maxNodes > 0 {
+				pl.setBudget(idx, as.maxNodes)
+			}
 		}
 		if pl.stacks.Next(idx) {
-			size := getSize()
+			size := as.size(args, getSize)
+			if budget := pl.budget(idx); budget != nil {
+				size = budget.take(size)
+			}
 			sv := reflect.MakeSlice(tp, size, size)
 			for i := 0; i < size; i++ {
-				ret, err := sub.create(args.Context(), nil, pl.Next(args))
+				ret, err := sub.create(args.Context(), as.elementOptions(i, args), pl.Next(args).at(name, i).bound())
 				if err != nil {
 					return nil, err
 				}
@@ -281,7 +549,91 @@ func (fa *Factory) SubRecursiveSliceFactory(name string, sub *Factory, getSize,
 			return sv.Interface(), nil
 		}
 		return nil, nil
+	})
+	ag.getLimit = getLimit
+	return fa
+}
+
+// createsObjects returns whether the attribute is created by a sub-factory.
+func (ag *attrGenerator) createsObjects() bool {
+	return ag.assoc != nil || ag.sub != nil
+}
+
+// setGen sets a generator of the attribute. kind is reported by Describe.
+func (fa *Factory) setGen(idx int, kind GeneratorKind, gen func(Args) (interface{}, error)) *attrGenerator {
+	ag := fa.attrGens[idx]
+	ag.kind = kind
+	ag.genFunc = gen
+	ag.assoc = nil
+	ag.assocGen = nil
+	ag.sub = nil
+	ag.getLimit = nil
+	return ag
+}
+
+// setAssoc sets a generator for the association; options given at creation time are applied to a copy of it.
+func (fa *Factory) setAssoc(idx int, kind GeneratorKind, as *association, gen func(Args, *association) (interface{}, error)) *attrGenerator {
+	ag := fa.setGen(idx, kind, func(args Args) (interface{}, error) {
+		return gen(args, as)
+	})
+	ag.assoc = as
+	ag.assocGen = gen
+	ag.sub = as.sub
+	return ag
+}
+
+// treeDepth returns the number of consecutive ancestors created by the same factory as args.
+func treeDepth(args Args) int {
+	depth := 0
+	for parent := args.Parent(); parent != nil && parent.Factory() == args.Factory(); parent = parent.Parent() {
+		depth++
 	}
+	return depth
+}
+
+// BackRef assigns the nearest ancestor object whose type is assignable to the attribute
+// when the object is created by a sub-factory of the ancestor's factory.
+func (fa *Factory) BackRef(name string) *Factory {
+	idx := fa.checkIdx(name)
+	ag := fa.attrGens[idx]
+	tp := fa.rt.Field(idx).Type
+	fa.setGen(idx, KindBackRef, func(args Args) (interface{}, error) {
+		ancestor := args.Ancestor(func(parent Args) bool {
+			return reflect.TypeOf(parent.Instance()).AssignableTo(tp)
+		})
+		if ancestor == nil {
+			return ag.value, nil
+		}
+		return ancestor.Instance(), nil
+	})
+	return fa
+}
+
+// BackRefKey copies the attribute `key` of the nearest ancestor object of the same type as model into the attribute `name`,
+// e.g. BackRefKey("GroupID", &Group{}, "ID") copies the ID of the group which the object belongs to.
+// The ancestor's attribute should be generated before the sub-factory which creates this object.
+func (fa *Factory) BackRefKey(name string, model interface{}, key string) *Factory {
+	idx := fa.checkIdx(name)
+	ag := fa.attrGens[idx]
+	tp := fa.rt.Field(idx).Type
+	fa.setGen(idx, KindBackRefKey, func(args Args) (interface{}, error) {
+		ancestor, ok := args.AncestorOf(model).(*argsStruct)
+		if !ok {
+			return ag.value, nil
+		}
+		aidx, ok := ancestor.fa.nameIndexMap[key]
+		if !ok {
+			return nil, fmt.Errorf("ancestor %v has no attribute %v", ancestor.fa.modelName(), key)
+		}
+		rv := reflect.Indirect(*ancestor.rv).Field(aidx)
+		if !rv.Type().AssignableTo(tp) {
+			if !rv.Type().ConvertibleTo(tp) {
+				return nil, fmt.Errorf("%v.%v cannot be assigned to %v.%v", ancestor.fa.modelName(), key, fa.modelName(), name)
+			}
+			rv = rv.Convert(tp)
+		}
+		return rv.Interface(), nil
+	})
 	return fa
 }
 
@@ -364,19 +716,44 @@ func (fa *Factory) ConstructWithContextAndOption(ctx context.Context, ptr interf
 		return errors.New("ptr should be pointer type.")
 	}
 	pt = pt.Elem()
+	fa, err := fa.tryResolve()
+	if err != nil {
+		return err
+	}
 	if pt.Name() != fa.modelName() {
 		return errors.New("ptr type should be " + fa.modelName())
 	}
 
 	inst := reflect.ValueOf(ptr).Elem()
-	_, err := fa.build(ctx, &inst, pt, opt, nil)
+	_, err = fa.build(ctx, &inst, pt, opt, nil)
 	return err
 }
 
-func (fa *Factory) build(ctx context.Context, inst *reflect.Value, tp reflect.Type, opt map[string]interface{}, pl *pipeline) (interface{}, error) {
+// build applies the generators to inst, or to a new object if inst is nil.
+func (fa *Factory) build(ctx context.Context, inst *reflect.Value, tp reflect.Type, opt map[string]interface{}, pl *pipeline) (ret interface{}, err error) {
+	start := time.Now()
+	var genTime, hookTime time.Duration
+	defer func() {
+		fa.recordStats(pl, time.Since(start), genTime, hookTime, err)
+	}()
+
+	opt, err = fa.applyTraits(opt)
+	if err != nil {
+		return nil, err
+	}
+
 	args := &argsStruct{}
 	args.pl = pl
 	args.ctx = ctx
+	args.fa = fa
+	args.opt = opt
+	if inst == nil {
+		v, err := fa.newInstance(args)
+		if err != nil {
+			return nil, err
+		}
+		inst = &v
+	}
 	if fa.isPtr {
 		addr := (*inst).Addr()
 		args.rv = &addr
@@ -384,33 +761,47 @@ func (fa *Factory) build(ctx context.Context, inst *reflect.Value, tp reflect.Ty
 		args.rv = inst
 	}
 
-	for i := 0; i < fa.numField; i++ {
-		if v, ok := opt[fa.attrGens[i].key]; ok {
-			inst.Field(i).Set(reflect.ValueOf(v))
-		} else {
-			ag := fa.attrGens[i]
-			if ag.genFunc == nil {
-				if !ag.isNil {
-					inst.Field(i).Set(reflect.ValueOf(ag.value))
-				}
-			} else {
-				v, err := ag.genFunc(args)
-				if err != nil {
-					return nil, err
-				}
-				if v != nil {
-					inst.Field(i).Set(reflect.ValueOf(v))
-				}
-			}
+	tr := tracerFrom(ctx)
+	if tr != nil {
+		start := time.Now()
+		tr.EnterFactory(args)
+		defer func() {
+			tr.ExitFactory(args, time.Since(start), err)
+		}()
+	}
+	if err := args.pipeline(fa.numField).scope.enter(args); err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			args.releaseUnique()
 		}
+	}()
+
+	if len(fa.uniques) > 0 || len(fa.validators) > 0 || fa.validateModel {
+		// attributes are regenerated from the values before generation.
+		args.base = reflect.New(inst.Type()).Elem()
+		args.base.Set(*inst)
 	}
 
-	for k, v := range opt {
-		setValueWithAttrPath(inst, tp, k, v)
+	genStart := time.Now()
+	err = fa.generate(args, inst, tp, opt, tr, false)
+	if err == nil {
+		err = fa.validate(args, inst, tp, opt, tr)
+	}
+	genTime = time.Since(genStart) - time.Duration(atomic.LoadInt64(&args.subTime))
+	if err != nil {
+		return nil, err
 	}
 
 	if fa.onCreate != nil {
-		if err := fa.onCreate(args); err != nil {
+		start := time.Now()
+		err := fa.onCreate(args)
+		hookTime = time.Since(start)
+		if tr != nil {
+			tr.Hook(args, "OnCreate", hookTime, err)
+		}
+		if err != nil {
 			return nil, err
 		}
 	}
@@ -421,7 +812,90 @@ func (fa *Factory) build(ctx context.Context, inst *reflect.Value, tp reflect.Ty
 	return inst.Interface(), nil
 }
 
+// generate sets all attributes of the object.
+// On retry, the attributes created by sub-factories are kept, so the rejected attempts do not leave objects behind, e.g. in a database.
+func (fa *Factory) generate(args *argsStruct, inst *reflect.Value, tp reflect.Type, opt map[string]interface{}, tr Tracer, retry bool) error {
+	for i := 0; i < fa.numField; i++ {
+		if retry {
+			if fa.attrGens[i].createsObjects() {
+				continue
+			}
+			fa.resetAttr(args, inst, i)
+		}
+		if err := fa.setAttr(args, inst, i, opt, tr); err != nil {
+			return err
+		}
+	}
+
+	for k, v := range opt {
+		setValueWithAttrPath(inst, tp, k, v)
+	}
+	return fa.checkUnique(args, inst, opt, tr)
+}
+
+// resetAttr restores the i-th attribute to its value before generation, so it can be regenerated.
+func (fa *Factory) resetAttr(args *argsStruct, inst *reflect.Value, i int) {
+	if args.base.IsValid() && inst.Field(i).CanSet() {
+		inst.Field(i).Set(args.base.Field(i))
+	}
+}
+
+// setAttr generates the i-th attribute and sets it to inst.
+func (fa *Factory) setAttr(args Args, inst *reflect.Value, i int, opt map[string]interface{}, tr Tracer) error {
+	ag := fa.attrGens[i]
+	start := time.Now()
+	v, source, err := fa.genAttr(args, ag, opt)
+	if err == nil {
+		if v != nil {
+			inst.Field(i).Set(reflect.ValueOf(v))
+		} else if source == SourceOverride || source == SourceNull {
+			inst.Field(i).Set(reflect.Zero(inst.Field(i).Type()))
+		}
+	}
+	if tr != nil {
+		tr.Attr(args, AttrEvent{Name: ag.key, Source: source, Value: v, Elapsed: time.Since(start), Err: err})
+	}
+	return err
+}
+
+// genAttr returns the value of the attribute: the value given at creation time, the default value or a generated value.
+// A nil value means that the attribute is not set.
+func (fa *Factory) genAttr(args Args, ag *attrGenerator, opt map[string]interface{}) (interface{}, AttrSource, error) {
+	if v, ok := opt[ag.key]; ok {
+		if aopt, ok := v.(AssocOption); ok && ag.assoc != nil {
+			v, err := ag.assocGen(args, ag.assoc.with(aopt))
+			return v, SourceSubFactory, err
+		}
+		return v, SourceOverride, nil
+	}
+	if ag.nullable > 0 && random.float64() < ag.nullable {
+		return nil, SourceNull, nil
+	}
+	if ag.genFunc == nil {
+		if ag.isNil || fa.ctor != nil {
+			return nil, SourceDefault, nil
+		}
+		return ag.value, SourceDefault, nil
+	}
+	v, err := ag.genFunc(args)
+	if ag.createsObjects() {
+		return v, SourceSubFactory, err
+	}
+	return v, SourceGenerator, err
+}
+
 func (fa *Factory) create(ctx context.Context, opt map[string]interface{}, pl *pipeline) (interface{}, error) {
-	inst := reflect.New(fa.rt).Elem()
-	return fa.build(ctx, &inst, fa.rt, opt, pl)
+	fa, err := fa.tryResolve()
+	if err != nil {
+		return nil, err
+	}
+	return fa.build(ctx, nil, fa.rt, opt, pl)
+}
+
+// newInstance returns a new object to which the generators are applied.
+func (fa *Factory) newInstance(args Args) (reflect.Value, error) {
+	if fa.ctor == nil {
+		return reflect.New(fa.rt).Elem(), nil
+	}
+	return fa.ctor(args)
 }
@@ -2,6 +2,9 @@ package factory
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
 	"sync"
 	"testing"
 )
@@ -169,6 +172,56 @@ func TestSubSliceFactory(t *testing.T) {
 	}
 }
 
+func TestSubMapFactory(t *testing.T) {
+	type User struct {
+		Email     string
+		GroupName string
+	}
+	type Group struct {
+		Name    string
+		Members map[string]*User
+	}
+
+	userFactory := NewFactory(&User{}).
+		SeqString("Email", func(s string) (interface{}, error) {
+			return "user-" + s + "@example.com", nil
+		}).
+		Attr("GroupName", func(args Args) (interface{}, error) {
+			if parent := args.Parent(); parent != nil {
+				return parent.Instance().(*Group).Name, nil
+			}
+			return "", nil
+		})
+
+	groupFactory := NewFactory(&Group{Name: "admins"}).
+		SubMapFactory("Members", userFactory, func() int { return 3 }, func(args Args) (interface{}, error) {
+			return args.Instance().(*User).Email, nil
+		})
+
+	group := groupFactory.MustCreate().(*Group)
+	if len(group.Members) != 3 {
+		t.Errorf("len(group.Members) should be 3, not %v", len(group.Members))
+		return
+	}
+	for key, user := range group.Members {
+		if key != user.Email {
+			t.Errorf("group.Members[%v].Email should be %v, not %v", key, key, user.Email)
+		}
+		if user.GroupName != "admins" {
+			t.Errorf("group.Members[%v].GroupName should be admins, not %v", key, user.GroupName)
+		}
+	}
+
+	_, err := NewFactory(&Group{}).
+		SubMapFactory("Members", userFactory, func() int { return 2 }, func(args Args) (interface{}, error) {
+			return "same", nil
+		}).
+		Create()
+	if err == nil {
+		t.Error("duplicate keys should cause an error")
+	}
+}
+
 func TestSubRecursiveFactory(t *testing.T) {
 	type User struct {
 		ID     int
@@ -272,6 +325,163 @@ func TestFactoryWhenCallArgsParent(t *testing.T) {
 	}
 }
 
+type backRefGroup struct {
+	ID    int64
+	Users []*backRefUser
+	Posts []*backRefPost
+}
+
+type backRefPost struct {
+	ID     int
+	Author *backRefUser
+}
+
+type backRefUser struct {
+	GroupID int
+	Group   *backRefGroup
+}
+
+func TestFactoryBackRef(t *testing.T) {
+	userFactory := NewFactory(&backRefUser{GroupID: -1}).
+		BackRef("Group").
+		BackRefKey("GroupID", &backRefGroup{}, "ID")
+	groupFactory := NewFactory(&backRefGroup{ID: 7}).
+		SubSliceFactory("Users", userFactory, func() int { return 2 })
+
+	group := groupFactory.MustCreate().(*backRefGroup)
+	for _, user := range group.Users {
+		if user.Group != group {
+			t.Error("user.Group should be the parent group.")
+		}
+		if user.GroupID != 7 {
+			t.Errorf("user.GroupID should be 7, not %v", user.GroupID)
+		}
+	}
+
+	postFactory := NewFactory(&backRefPost{ID: 77}).SubFactory("Author", userFactory)
+	post := postFactory.MustCreate().(*backRefPost)
+	if post.Author.Group != nil || post.Author.GroupID != -1 {
+		t.Errorf("the author of a post should not refer to the post as its group: %+v", post.Author)
+	}
+
+	group = groupFactory.SubSliceFactory("Posts", postFactory, func() int { return 1 }).MustCreate().(*backRefGroup)
+	if author := group.Posts[0].Author; author.Group != group || author.GroupID != 7 {
+		t.Errorf("the author of a post should refer to the group of the post: %+v", author)
+	}
+
+	user := userFactory.MustCreate().(*backRefUser)
+	if user.Group != nil {
+		t.Error("user.Group should be nil without a parent.")
+	}
+	if user.GroupID != -1 {
+		t.Errorf("user.GroupID should be the default value -1, not %v", user.GroupID)
+	}
+}
+
+func TestFactoryArgsMetadata(t *testing.T) {
+	type User struct {
+		Name string
+		Path string
+	}
+	type Group struct {
+		Name  string
+		Users []*User
+	}
+
+	var userFactory *Factory
+	userFactory = NewFactory(&User{}).
+		Attr("Name", func(args Args) (interface{}, error) {
+			if args.Factory() != userFactory {
+				return nil, errors.New("args.Factory() should be userFactory")
+			}
+			return fmt.Sprintf("user-%d-depth-%d", args.Index(), args.Depth()), nil
+		}).
+		Attr("Path", func(args Args) (interface{}, error) {
+			return args.Path(), nil
+		})
+	groupFactory := NewFactory(&Group{}).
+		Attr("Name", func(args Args) (interface{}, error) {
+			if args.Depth() != 0 || args.Index() != -1 {
+				return nil, fmt.Errorf("unexpected depth %v and index %v", args.Depth(), args.Index())
+			}
+			return args.Options()["Label"], nil
+		}).
+		SubSliceFactory("Users", userFactory, func() int { return 2 })
+
+	group := groupFactory.MustCreateWithOption(map[string]interface{}{"Label": "admins"}).(*Group)
+	if group.Name != "admins" {
+		t.Errorf("group.Name should be admins, not %v", group.Name)
+	}
+	for i, user := range group.Users {
+		if expected := fmt.Sprintf("user-%d-depth-1", i); user.Name != expected {
+			t.Errorf("user.Name should be %v, not %v", expected, user.Name)
+		}
+		if expected := fmt.Sprintf("Group.Users[%d]", i); user.Path != expected {
+			t.Errorf("user.Path should be %v, not %v", expected, user.Path)
+		}
+	}
+}
+
+func TestFactoryArgsAncestors(t *testing.T) {
+	type Comment struct {
+		Author string
+		Title  string
+		Root   string
+	}
+	type Post struct {
+		Title    string
+		Comments []*Comment
+	}
+	type User struct {
+		Name  string
+		Posts []*Post
+	}
+
+	commentFactory := NewFactory(&Comment{}).
+		Attr("Author", func(args Args) (interface{}, error) {
+			return args.AncestorOf(&User{}).Instance().(*User).Name, nil
+		}).
+		Attr("Title", func(args Args) (interface{}, error) {
+			return args.Ancestor(func(parent Args) bool {
+				_, ok := parent.Instance().(*Post)
+				return ok
+			}).Instance().(*Post).Title, nil
+		}).
+		Attr("Root", func(args Args) (interface{}, error) {
+			return args.Root().Path(), nil
+		})
+	postFactory := NewFactory(&Post{Title: "hello"}).
+		SubSliceFactory("Comments", commentFactory, func() int { return 1 })
+	userFactory := NewFactory(&User{Name: "bluele"}).
+		SubSliceFactory("Posts", postFactory, func() int { return 1 })
+
+	comment := userFactory.MustCreate().(*User).Posts[0].Comments[0]
+	if comment.Author != "bluele" {
+		t.Errorf("comment.Author should be bluele, not %v", comment.Author)
+	}
+	if comment.Title != "hello" {
+		t.Errorf("comment.Title should be hello, not %v", comment.Title)
+	}
+	if comment.Root != "User" {
+		t.Errorf("comment.Root should be User, not %v", comment.Root)
+	}
+
+	titleFactory := NewFactory(&Post{}).
+		Attr("Title", func(args Args) (interface{}, error) {
+			if ancestor := args.AncestorFrom(userFactory); ancestor != nil {
+				return ancestor.Instance().(*User).Name + "'s post", nil
+			}
+			return "orphan", nil
+		})
+	if post := titleFactory.MustCreate().(*Post); post.Title != "orphan" {
+		t.Errorf("post.Title should be orphan, not %v", post.Title)
+	}
+	userFactory.SubSliceFactory("Posts", titleFactory, func() int { return 1 })
+	if post := userFactory.MustCreate().(*User).Posts[0]; post.Title != "bluele's post" {
+		t.Errorf("post.Title should be bluele's post, not %v", post.Title)
+	}
+}
+
 func TestFactoryWithOptions(t *testing.T) {
 	type (
 		Group struct {
@@ -492,3 +702,53 @@ func TestFactorySeqStringStartsAt1(t *testing.T) {
 		t.Errorf("the starting number for SeqString was %s, not 1", name)
 	}
 }
+
+type ctorOrder struct {
+	ID     int
+	Status string
+	Items  map[string]int
+	secret string
+}
+
+func newCtorOrder() *ctorOrder {
+	return &ctorOrder{Status: "new", Items: map[string]int{}, secret: "s"}
+}
+
+func TestNewFactoryFunc(t *testing.T) {
+	orderFactory := NewFactoryFunc(func(args Args) (*ctorOrder, error) {
+		if args.Instance() != nil {
+			return nil, errors.New("args.Instance() should be nil in the constructor")
+		}
+		return newCtorOrder(), nil
+	}).SeqInt("ID", func(n int) (interface{}, error) {
+		return n, nil
+	})
+
+	order := orderFactory.MustCreateWithOption(map[string]interface{}{"Status": "paid"}).(*ctorOrder)
+	if order.ID != 1 {
+		t.Errorf("order.ID should be 1, not %v", order.ID)
+	}
+	if order.Status != "paid" {
+		t.Errorf("order.Status should be paid, not %v", order.Status)
+	}
+	if order.Items == nil || order.secret != "s" {
+		t.Errorf("order should be initialized by the constructor: %+v", order)
+	}
+	if orderFactory.ModelType() != reflect.TypeOf(&ctorOrder{}) {
+		t.Errorf("ModelType should be *ctorOrder, not %v", orderFactory.ModelType())
+	}
+
+	failed := NewFactoryFunc(func(Args) (*ctorOrder, error) {
+		return nil, errors.New("failed")
+	})
+	if _, err := failed.Create(); err == nil || err.Error() != "failed" {
+		t.Errorf("Create should return the error of the constructor, not %v", err)
+	}
+
+	valueFactory := NewFactoryFunc(func(Args) (ctorOrder, error) {
+		return *newCtorOrder(), nil
+	})
+	if order := valueFactory.MustCreate().(ctorOrder); order.Status != "new" {
+		t.Errorf("order.Status should be new, not %v", order.Status)
+	}
+}
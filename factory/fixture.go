@@ -0,0 +1,238 @@
+package factory
+
+import (
+	"context"
+	"io/ioutil"
+	"reflect"
+	"strings"
+)
+
+/*
+Fixture sets are JSON files which list labelled objects by the names of registered factories:
+
+	{
+	  "group": {
+	    "admins": {"Name": "Admins"}
+	  },
+	  "user": {
+	    "alice": {"Name": "Alice", "Group": "$admins"},
+	    "bob":   {"Name": "Bob", "Group": "$admins"}
+	  }
+	}
+
+Each object is created by the factory with the given attribute values, so the other attributes are still generated.
+A string "$label" refers to the object with the label, and a list of them makes a slice. "$$" escapes a leading "$".
+Objects are created after the objects they refer to, regardless of the order in the file.
+*/
+
+// FixtureSet holds the objects created from a fixture file by their labels.
+type FixtureSet struct {
+	objects map[string]interface{}
+	labels  []string // creation order
+}
+
+// Get returns the object with the label.
+func (fs *FixtureSet) Get(label string) (interface{}, bool) {
+	obj, ok := fs.objects[label]
+	return obj, ok
+}
+
+// MustGet returns the object with the label, or panics if there is no such object.
+func (fs *FixtureSet) MustGet(label string) interface{} {
+	obj, ok := fs.Get(label)
+	if !ok {
+		panic("factory: no fixture is labelled " + label)
+	}
+	return obj
+}
+
+// Labels returns the labels in creation order.
+func (fs *FixtureSet) Labels() []string {
+	return append([]string(nil), fs.labels...)
+}
+
+// LoadFixtures reads a fixture file and creates its objects with the registered factories.
+// ctx is passed to the factories, e.g. for OnCreate callbacks.
+func (r *Registry) LoadFixtures(ctx context.Context, path string) (*FixtureSet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return r.ParseFixtures(ctx, path, data)
+}
+
+// ParseFixtures parses fixtures and creates their objects with the registered factories. file is used for error messages.
+func (r *Registry) ParseFixtures(ctx context.Context, file string, data []byte) (*FixtureSet, error) {
+	root, err := parseJSON(file, data)
+	if err != nil {
+		return nil, err
+	}
+	if root.kind != '{' {
+		return nil, root.errorf("fixtures should be an object")
+	}
+
+	var fixtures []*fixture
+	byLabel := make(map[string]*fixture)
+	for _, group := range root.fields {
+		fa, ok := r.Get(group.key)
+		if !ok {
+			return nil, group.value.errorf("no factory is registered as %v", group.key)
+		}
+		if group.value.kind != '{' {
+			return nil, group.value.errorf("fixtures of %v should be an object", group.key)
+		}
+		for _, field := range group.value.fields {
+			if _, ok := byLabel[field.key]; ok {
+				return nil, field.value.errorf("duplicate label %v", field.key)
+			}
+			if field.value.kind != '{' {
+				return nil, field.value.errorf("fixture %v should be an object", field.key)
+			}
+			resolved, err := fa.tryResolve()
+			if err != nil {
+				return nil, group.value.errorf("%v", err)
+			}
+			fx := &fixture{label: field.key, fa: resolved, node: field.value}
+			fixtures = append(fixtures, fx)
+			byLabel[fx.label] = fx
+		}
+	}
+
+	fs := &FixtureSet{objects: make(map[string]interface{})}
+	state := make(map[*fixture]int) // 1: creating, 2: created
+	var create func(fx *fixture) error
+	create = func(fx *fixture) error {
+		switch state[fx] {
+		case 1:
+			return fx.node.errorf("circular reference of %v", fx.label)
+		case 2:
+			return nil
+		}
+		state[fx] = 1
+		for _, dep := range fx.refs() {
+			to, ok := byLabel[dep.label]
+			if !ok {
+				return dep.node.errorf("no fixture is labelled %v", dep.label)
+			}
+			if err := create(to); err != nil {
+				return err
+			}
+		}
+		opt, err := fx.options(fs)
+		if err != nil {
+			return err
+		}
+		obj, err := fx.fa.CreateWithContextAndOption(ctx, opt)
+		if err != nil {
+			return fx.node.errorf("failed to create %v: %v", fx.label, err)
+		}
+		fs.objects[fx.label] = obj
+		fs.labels = append(fs.labels, fx.label)
+		state[fx] = 2
+		return nil
+	}
+	for _, fx := range fixtures {
+		if err := create(fx); err != nil {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+// LoadFixtures reads a fixture file and creates its objects with the factories in DefaultRegistry.
+func LoadFixtures(ctx context.Context, path string) (*FixtureSet, error) {
+	return DefaultRegistry.LoadFixtures(ctx, path)
+}
+
+type fixture struct {
+	label string
+	fa    *Factory
+	node  *jsonNode
+}
+
+type fixtureRef struct {
+	label string
+	node  *jsonNode
+}
+
+// refs returns the labels which the attribute values refer to.
+func (fx *fixture) refs() []fixtureRef {
+	var refs []fixtureRef
+	for _, field := range fx.node.fields {
+		nodes := []*jsonNode{field.value}
+		if field.value.kind == '[' {
+			nodes = field.value.items
+		}
+		for _, node := range nodes {
+			if label, ok := refLabel(node); ok {
+				refs = append(refs, fixtureRef{label: label, node: node})
+			}
+		}
+	}
+	return refs
+}
+
+// options returns the attribute values, resolving references to created objects.
+func (fx *fixture) options(fs *FixtureSet) (map[string]interface{}, error) {
+	opt := make(map[string]interface{})
+	for _, field := range fx.node.fields {
+		idx, ok := fx.fa.nameIndexMap[field.key]
+		if !ok {
+			return nil, field.value.errorf("%v has no attribute %v", fx.fa.modelName(), field.key)
+		}
+		tp := fx.fa.rt.Field(idx).Type
+		v, err := fixtureValue(fs, field.value, tp)
+		if err != nil {
+			return nil, err
+		}
+		opt[field.key] = v
+	}
+	return opt, nil
+}
+
+func fixtureValue(fs *FixtureSet, node *jsonNode, tp reflect.Type) (interface{}, error) {
+	if label, ok := refLabel(node); ok {
+		obj := fs.objects[label]
+		if !reflect.TypeOf(obj).AssignableTo(tp) {
+			return nil, node.errorf("%v is %T, which cannot be assigned to %v", label, obj, tp)
+		}
+		return obj, nil
+	}
+	if node.kind == '[' && tp.Kind() == reflect.Slice && hasRef(node.items) {
+		// items are resolved one by one, like refs treats them, so references can be mixed with other values.
+		sv := reflect.MakeSlice(tp, len(node.items), len(node.items))
+		for i, item := range node.items {
+			v, err := fixtureValue(fs, item, tp.Elem())
+			if err != nil {
+				return nil, err
+			}
+			if v != nil {
+				sv.Index(i).Set(reflect.ValueOf(v))
+			}
+		}
+		return sv.Interface(), nil
+	}
+	if s, ok := node.value.(string); ok && strings.HasPrefix(s, "$$") && tp.Kind() == reflect.String {
+		return reflect.ValueOf(s[1:]).Convert(tp).Interface(), nil
+	}
+	return node.decode(tp)
+}
+
+// hasRef reports whether any of the nodes is a reference.
+func hasRef(nodes []*jsonNode) bool {
+	for _, node := range nodes {
+		if _, ok := refLabel(node); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// refLabel returns the label if node is a reference like "$label".
+func refLabel(node *jsonNode) (string, bool) {
+	s, ok := node.value.(string)
+	if !ok || !strings.HasPrefix(s, "$") || strings.HasPrefix(s, "$$") || len(s) == 1 {
+		return "", false
+	}
+	return s[1:], true
+}
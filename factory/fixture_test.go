@@ -0,0 +1,104 @@
+package factory
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+type fixtureGroup struct {
+	ID      int
+	Name    string
+	Members []*fixtureUser
+	Tags    []string
+}
+
+type fixtureUser struct {
+	ID    int
+	Name  string
+	Email string
+	Group *fixtureGroup
+}
+
+func newFixtureRegistry() *Registry {
+	registry := NewRegistry()
+	registry.MustRegister("group", NewFactory(&fixtureGroup{}).
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		}))
+	registry.MustRegister("user", NewFactory(&fixtureUser{}).
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		}).
+		Attr("Email", func(args Args) (interface{}, error) {
+			return strings.ToLower(args.Instance().(*fixtureUser).Name) + "@example.com", nil
+		}))
+	return registry
+}
+
+func TestParseFixtures(t *testing.T) {
+	fs, err := newFixtureRegistry().ParseFixtures(context.Background(), "fixtures.json", []byte(`{
+  "user": {
+    "alice": {"Name": "Alice", "Group": "$admins"},
+    "bob": {"Name": "$$bob"}
+  },
+  "group": {
+    "admins": {"Name": "Admins"},
+    "all": {"Name": "All", "Members": ["$alice", "$bob"]},
+    "mixed": {"Name": "Mixed", "Members": [{"Name": "Carol"}, "$alice"]}
+  }
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := fs.MustGet("alice").(*fixtureUser)
+	admins := fs.MustGet("admins").(*fixtureGroup)
+	if alice.Group != admins || admins.Name != "Admins" {
+		t.Errorf("alice.Group should be admins, not %+v", alice.Group)
+	}
+	if alice.Email != "alice@example.com" || alice.ID == 0 {
+		t.Errorf("unspecified attributes of alice should be generated: %+v", alice)
+	}
+	if bob := fs.MustGet("bob").(*fixtureUser); bob.Name != "$bob" {
+		t.Errorf("bob.Name should be $bob, not %v", bob.Name)
+	}
+	all := fs.MustGet("all").(*fixtureGroup)
+	if len(all.Members) != 2 || all.Members[0] != alice {
+		t.Errorf("unexpected all.Members: %v", all.Members)
+	}
+
+	mixed := fs.MustGet("mixed").(*fixtureGroup)
+	if len(mixed.Members) != 2 || mixed.Members[0].Name != "Carol" || mixed.Members[1] != alice {
+		t.Errorf("unexpected mixed.Members: %v", mixed.Members)
+	}
+
+	labels := fs.Labels()
+	if labels[0] != "admins" || labels[1] != "alice" {
+		t.Errorf("admins should be created before alice: %v", labels)
+	}
+	if _, ok := fs.Get("unknown"); ok {
+		t.Error(`fs.Get("unknown") should not return an object`)
+	}
+}
+
+func TestParseFixturesErrors(t *testing.T) {
+	for _, tc := range []struct {
+		data string
+		err  string
+	}{
+		{`{"unknown": {}}`, "fixtures.json:1: no factory is registered as unknown"},
+		{"{\"user\": {\n\"alice\": {\"Group\": \"$admins\"}}}", "fixtures.json:2: no fixture is labelled admins"},
+		{`{"user": {"alice": {"Group": "$bob"}, "bob": {"Group": "$alice"}}}`, "circular reference"},
+		{`{"user": {"alice": {}}, "group": {"alice": {}}}`, "duplicate label alice"},
+		{`{"user": {"alice": {}}, "group": {"admins": {"Name": "$alice"}}}`, "cannot be assigned"},
+		{`{"user": {"alice": {}}, "group": {"admins": {"Tags": ["x", "$alice"]}}}`, "cannot be assigned"},
+	} {
+		_, err := newFixtureRegistry().ParseFixtures(context.Background(), "fixtures.json", []byte(tc.data))
+		if err == nil {
+			t.Errorf("%v should cause an error", tc.data)
+		} else if !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("error of %v should contain %q, not %q", tc.data, tc.err, err)
+		}
+	}
+}
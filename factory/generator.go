@@ -0,0 +1,134 @@
+package factory
+
+import (
+	"math/rand"
+	"sync/atomic"
+	"time"
+)
+
+// The generators in this file can be passed to Attr, e.g. Attr("Role", factory.OneOf("admin", "member")).
+// The random ones use the random source of SetSeed. Values are returned as they are given,
+// so they should have the type of the field, e.g. OneOf(int64(1), int64(2)) for an int64 field.
+
+// OneOf returns a generator which picks one of values at random.
+func OneOf(values ...interface{}) func(Args) (interface{}, error) {
+	if len(values) == 0 {
+		panic("OneOf: values should not be empty")
+	}
+	return func(Args) (interface{}, error) {
+		return values[random.intn(len(values))], nil
+	}
+}
+
+// WeightedValue is a value with its relative weight for WeightedOneOf.
+type WeightedValue struct {
+	Value  interface{}
+	Weight int
+}
+
+// WeightedOneOf returns a generator which picks one of values at random with probability proportional to its weight.
+func WeightedOneOf(values ...WeightedValue) func(Args) (interface{}, error) {
+	total := 0
+	for _, v := range values {
+		if v.Weight < 0 {
+			panic("WeightedOneOf: weights should not be negative")
+		}
+		total += v.Weight
+	}
+	if total == 0 {
+		panic("WeightedOneOf: the total weight should be positive")
+	}
+	return func(Args) (interface{}, error) {
+		n := random.intn(total)
+		for _, v := range values {
+			if n < v.Weight {
+				return v.Value, nil
+			}
+			n -= v.Weight
+		}
+		panic("unreachable")
+	}
+}
+
+// Cycle returns a generator which returns values in turn, starting from the first one.
+func Cycle(values ...interface{}) func(Args) (interface{}, error) {
+	if len(values) == 0 {
+		panic("Cycle: values should not be empty")
+	}
+	var seq int64 = -1
+	return func(Args) (interface{}, error) {
+		n := atomic.AddInt64(&seq, 1)
+		return values[n%int64(len(values))], nil
+	}
+}
+
+// IntRange returns a generator of ints in [min, max].
+func IntRange(min, max int) func(Args) (interface{}, error) {
+	if min > max {
+		panic("IntRange: min should not be greater than max")
+	}
+	return func(Args) (interface{}, error) {
+		return int(random.int64Range(int64(min), int64(max))), nil
+	}
+}
+
+// Int64Range returns a generator of int64s in [min, max].
+func Int64Range(min, max int64) func(Args) (interface{}, error) {
+	if min > max {
+		panic("Int64Range: min should not be greater than max")
+	}
+	return func(Args) (interface{}, error) {
+		return random.int64Range(min, max), nil
+	}
+}
+
+// FloatRange returns a generator of float64s in [min, max).
+func FloatRange(min, max float64) func(Args) (interface{}, error) {
+	if min > max {
+		panic("FloatRange: min should not be greater than max")
+	}
+	return func(Args) (interface{}, error) {
+		return min + random.float64()*(max-min), nil
+	}
+}
+
+// Normal returns a generator of float64s which follow the normal distribution.
+func Normal(mean, stddev float64) func(Args) (interface{}, error) {
+	return func(Args) (interface{}, error) {
+		return mean + random.normFloat64()*stddev, nil
+	}
+}
+
+// Zipf returns a generator of ints in [0, max] which follow the Zipf distribution,
+// where the probability of k is proportional to (v + k) ** (-s). s should be greater than 1 and v should be at least 1.
+// It is useful for skewed data, e.g. a few users who have most of the posts.
+func Zipf(s, v float64, max int) func(Args) (interface{}, error) {
+	z := rand.NewZipf(random.rnd, s, v, uint64(max))
+	if z == nil {
+		panic("Zipf: s should be greater than 1 and v should be at least 1")
+	}
+	return func(Args) (interface{}, error) {
+		return int(random.zipf(z)), nil
+	}
+}
+
+// TimeRange returns a generator of times in [from, to).
+func TimeRange(from, to time.Time) func(Args) (interface{}, error) {
+	d := to.Sub(from)
+	if d <= 0 {
+		panic("TimeRange: from should be before to")
+	}
+	return func(Args) (interface{}, error) {
+		return from.Add(time.Duration(random.int63n(int64(d)))), nil
+	}
+}
+
+// DurationRange returns a generator of durations in [min, max).
+func DurationRange(min, max time.Duration) func(Args) (interface{}, error) {
+	if min >= max {
+		panic("DurationRange: min should be less than max")
+	}
+	return func(Args) (interface{}, error) {
+		return min + time.Duration(random.int63n(int64(max-min))), nil
+	}
+}
@@ -0,0 +1,103 @@
+package factory
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestGenerators(t *testing.T) {
+	type Event struct {
+		Kind     string
+		Priority string
+		Room     string
+		Seats    int
+		Ticket   int64
+		Price    float64
+		Score    float64
+		Rank     int
+		StartAt  time.Time
+		Duration time.Duration
+	}
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	eventFactory := NewFactory(&Event{}).
+		Attr("Kind", OneOf("talk", "workshop")).
+		Attr("Priority", WeightedOneOf(WeightedValue{Value: "high", Weight: 0}, WeightedValue{Value: "low", Weight: 3})).
+		Attr("Room", Cycle("A", "B", "C")).
+		Attr("Seats", IntRange(10, 12)).
+		Attr("Ticket", Int64Range(-1, 1)).
+		Attr("Price", FloatRange(1, 2)).
+		Attr("Score", Normal(50, 10)).
+		Attr("Rank", Zipf(2, 1, 5)).
+		Attr("StartAt", TimeRange(from, to)).
+		Attr("Duration", DurationRange(time.Minute, time.Hour))
+
+	SetSeed(1)
+	var first []*Event
+	for i := 0; i < 30; i++ {
+		e := eventFactory.MustCreate().(*Event)
+		first = append(first, e)
+		if e.Kind != "talk" && e.Kind != "workshop" {
+			t.Errorf("e.Kind should be talk or workshop, not %v", e.Kind)
+		}
+		if e.Priority != "low" {
+			t.Errorf("e.Priority should be low, not %v", e.Priority)
+		}
+		if room := []string{"A", "B", "C"}[i%3]; e.Room != room {
+			t.Errorf("e.Room should be %v, not %v", room, e.Room)
+		}
+		if e.Seats < 10 || e.Seats > 12 {
+			t.Errorf("e.Seats should be in [10, 12], not %v", e.Seats)
+		}
+		if e.Ticket < -1 || e.Ticket > 1 {
+			t.Errorf("e.Ticket should be in [-1, 1], not %v", e.Ticket)
+		}
+		if e.Price < 1 || e.Price >= 2 {
+			t.Errorf("e.Price should be in [1, 2), not %v", e.Price)
+		}
+		if e.Rank < 0 || e.Rank > 5 {
+			t.Errorf("e.Rank should be in [0, 5], not %v", e.Rank)
+		}
+		if e.StartAt.Before(from) || !e.StartAt.Before(to) {
+			t.Errorf("e.StartAt should be in [%v, %v), not %v", from, to, e.StartAt)
+		}
+		if e.Duration < time.Minute || e.Duration >= time.Hour {
+			t.Errorf("e.Duration should be in [1m, 1h), not %v", e.Duration)
+		}
+	}
+
+	SetSeed(1)
+	for i := 0; i < 30; i++ {
+		e := eventFactory.MustCreate().(*Event)
+		if e.Seats != first[i].Seats || e.Score != first[i].Score || e.Rank != first[i].Rank || !e.StartAt.Equal(first[i].StartAt) {
+			t.Errorf("the same seed should generate the same values: %+v != %+v", e, first[i])
+		}
+	}
+}
+
+func TestIntRangeFullRange(t *testing.T) {
+	maxInt := int(^uint(0) >> 1)
+	for _, gen := range []func(Args) (interface{}, error){
+		IntRange(-1, maxInt),
+		IntRange(-maxInt-1, maxInt),
+		Int64Range(math.MinInt64, math.MaxInt64),
+		Int64Range(math.MinInt64, 0),
+		Int64Range(math.MaxInt64, math.MaxInt64),
+	} {
+		for i := 0; i < 100; i++ {
+			if _, err := gen(nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if v, _ := IntRange(-1, maxInt)(nil); v.(int) < -1 {
+			t.Errorf("IntRange(-1, maxInt) should not return %v", v)
+		}
+		if v, _ := Int64Range(math.MinInt64, 0)(nil); v.(int64) > 0 {
+			t.Errorf("Int64Range(math.MinInt64, 0) should not return %v", v)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package factory
+
+import (
+	"reflect"
+)
+
+// Optional wraps gen to return nil with probability p, which leaves the attribute as the zero value,
+// e.g. a nil pointer or an invalid sql.NullString.
+func Optional(p float64, gen func(Args) (interface{}, error)) func(Args) (interface{}, error) {
+	return func(args Args) (interface{}, error) {
+		if random.float64() < p {
+			return nil, nil
+		}
+		return gen(args)
+	}
+}
+
+// Nullable makes the attributes zero values with probability p instead of calling their generators,
+// so it also applies to sub-factory attributes. Values given at creation time are not affected.
+// Without names, it applies to all exported attributes which can be nil or invalid:
+// pointers, slices, maps, interfaces, and structs with a `Valid bool` field like sql.NullString.
+func (fa *Factory) Nullable(p float64, names ...string) *Factory {
+	if len(names) == 0 {
+		for i := 0; i < fa.numField; i++ {
+			if sf := fa.rt.Field(i); sf.PkgPath == "" && canBeNull(sf.Type) {
+				fa.attrGens[i].nullable = p
+			}
+		}
+		return fa
+	}
+	for _, name := range names {
+		fa.attrGens[fa.checkIdx(name)].nullable = p
+	}
+	return fa
+}
+
+func canBeNull(tp reflect.Type) bool {
+	switch tp.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Map, reflect.Interface:
+		return true
+	case reflect.Struct:
+		f, ok := tp.FieldByName("Valid")
+		return ok && f.Type.Kind() == reflect.Bool
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+package factory
+
+import (
+	"database/sql"
+	"testing"
+)
+
+func TestOptionalAndNullable(t *testing.T) {
+	type Group struct {
+		ID int
+	}
+	type User struct {
+		ID       int
+		Nickname *string
+		Email    sql.NullString
+		Group    *Group
+		Tags     []string
+	}
+
+	nickname := "blue"
+	userFactory := NewFactory(&User{ID: 1, Tags: []string{"a"}}).
+		Attr("Nickname", Optional(0.5, func(Args) (interface{}, error) {
+			return &nickname, nil
+		})).
+		Attr("Email", func(Args) (interface{}, error) {
+			return sql.NullString{String: "a@example.com", Valid: true}, nil
+		}).
+		SubFactory("Group", NewFactory(&Group{})).
+		Nullable(0.5)
+
+	SetSeed(1)
+	counts := make(map[string]int)
+	for i := 0; i < 100; i++ {
+		user := userFactory.MustCreate().(*User)
+		if user.ID != 1 {
+			t.Errorf("user.ID should not be nullable: %v", user.ID)
+		}
+		if user.Nickname == nil {
+			counts["Nickname"]++
+		}
+		if !user.Email.Valid {
+			counts["Email"]++
+		}
+		if user.Group == nil {
+			counts["Group"]++
+		}
+		if user.Tags == nil {
+			counts["Tags"]++
+		}
+	}
+	for _, name := range []string{"Nickname", "Email", "Group", "Tags"} {
+		if counts[name] < 20 || counts[name] > 90 {
+			t.Errorf("%v should be sometimes nil, but it is nil %v times of 100", name, counts[name])
+		}
+	}
+
+	always := NewFactory(&User{}).SubFactory("Group", NewFactory(&Group{})).Nullable(1, "Group")
+	if user := always.MustCreate().(*User); user.Group != nil {
+		t.Errorf("user.Group should be nil, not %v", user.Group)
+	}
+	group := &Group{ID: 2}
+	if user := always.MustCreateWithOption(map[string]interface{}{"Group": group}).(*User); user.Group != group {
+		t.Errorf("user.Group should be the given group, not %v", user.Group)
+	}
+}
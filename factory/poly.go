@@ -0,0 +1,113 @@
+package factory
+
+import (
+	"fmt"
+	"reflect"
+	"sync/atomic"
+)
+
+// Chooser chooses the factory of each object of a polymorphic sub-factory attribute.
+// args is the argument of the object which has the attribute, so a chooser can depend on its other attributes, e.g.
+//
+//	func(args factory.Args) (*factory.Factory, error) {
+//	  if args.Instance().(*Order).Kind == "card" {
+//	    return CardFactory, nil
+//	  }
+//	  return BankTransferFactory, nil
+//	}
+type Chooser func(args Args) (*Factory, error)
+
+// Choice is a factory with its relative weight for ChooseWeighted.
+type Choice struct {
+	Factory *Factory
+	Weight  int
+}
+
+// ChooseWeighted returns a chooser which chooses a random factory with probability proportional to its weight.
+func ChooseWeighted(choices ...Choice) Chooser {
+	total := 0
+	for _, c := range choices {
+		if c.Weight < 0 {
+			panic("ChooseWeighted: weights should not be negative")
+		}
+		total += c.Weight
+	}
+	if total == 0 {
+		panic("ChooseWeighted: the total weight should be positive")
+	}
+	return func(Args) (*Factory, error) {
+		n := random.intn(total)
+		for _, c := range choices {
+			if n < c.Weight {
+				return c.Factory, nil
+			}
+			n -= c.Weight
+		}
+		panic("unreachable")
+	}
+}
+
+// ChooseRoundRobin returns a chooser which chooses the factories in turn.
+func ChooseRoundRobin(factories ...*Factory) Chooser {
+	if len(factories) == 0 {
+		panic("ChooseRoundRobin: factories should not be empty")
+	}
+	var count int64 = -1
+	return func(Args) (*Factory, error) {
+		n := atomic.AddInt64(&count, 1)
+		return factories[n%int64(len(factories))], nil
+	}
+}
+
+// SubPolyFactory is like SubFactory, but chooses the factory of each object with choose.
+// It is useful for an interface field, e.g. `Payment PaymentMethod` implemented by several models.
+func (fa *Factory) SubPolyFactory(name string, choose Chooser, opts ...AssocOption) *Factory {
+	idx := fa.checkIdx(name)
+	tp := fa.rt.Field(idx).Type
+	as := newAssociation(name, nil, opts)
+	as.choose = choose
+	fa.setAssoc(idx, KindSubPoly, as, func(args Args, as *association) (interface{}, error) {
+		pipeline := args.pipeline(fa.numField)
+		ret, err := as.get(args, pipeline, -1)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAssignable(name, ret, tp); err != nil {
+			return nil, err
+		}
+		return ret, nil
+	})
+	return fa
+}
+
+// SubPolySliceFactory is like SubSliceFactory, but chooses the factory of each element with choose.
+func (fa *Factory) SubPolySliceFactory(name string, choose Chooser, getSize func() int, opts ...AssocOption) *Factory {
+	idx := fa.checkIdx(name)
+	tp := fa.rt.Field(idx).Type
+	as := newAssociation(name, nil, opts)
+	as.choose = choose
+	fa.setAssoc(idx, KindSubPolySlice, as, func(args Args, as *association) (interface{}, error) {
+		size := as.size(args, getSize)
+		pipeline := args.pipeline(fa.numField)
+		sv := reflect.MakeSlice(tp, size, size)
+		for i := 0; i < size; i++ {
+			ret, err := as.get(args, pipeline, i)
+			if err != nil {
+				return nil, err
+			}
+			if err := checkAssignable(name, ret, tp.Elem()); err != nil {
+				return nil, err
+			}
+			sv.Index(i).Set(reflect.ValueOf(ret))
+		}
+		return sv.Interface(), nil
+	})
+	return fa
+}
+
+func checkAssignable(name string, v interface{}, tp reflect.Type) error {
+	if !reflect.TypeOf(v).AssignableTo(tp) {
+		return fmt.Errorf("factory: %T cannot be assigned to attribute %v of type %v", v, name, tp)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package factory
+
+import (
+	"testing"
+)
+
+type polyPayment interface {
+	Amount() int
+}
+
+type polyCard struct {
+	Number string
+	Total  int
+}
+
+func (c *polyCard) Amount() int { return c.Total }
+
+type polyTransfer struct {
+	IBAN  string
+	Total int
+}
+
+func (t *polyTransfer) Amount() int { return t.Total }
+
+type polyOrder struct {
+	Kind     string
+	Payment  polyPayment
+	Payments []polyPayment
+}
+
+func TestSubPolyFactory(t *testing.T) {
+	cardFactory := NewFactory(&polyCard{Number: "4242", Total: 1})
+	transferFactory := NewFactory(&polyTransfer{IBAN: "DE00", Total: 2})
+
+	orderFactory := NewFactory(&polyOrder{Kind: "card"}).
+		SubPolyFactory("Payment", func(args Args) (*Factory, error) {
+			if args.Instance().(*polyOrder).Kind == "card" {
+				return cardFactory, nil
+			}
+			return transferFactory, nil
+		}).
+		SubPolySliceFactory("Payments", ChooseRoundRobin(cardFactory, transferFactory), func() int { return 3 })
+
+	order := orderFactory.MustCreate().(*polyOrder)
+	if _, ok := order.Payment.(*polyCard); !ok {
+		t.Errorf("order.Payment should be *polyCard, not %T", order.Payment)
+	}
+	if len(order.Payments) != 3 {
+		t.Fatalf("len(order.Payments) should be 3, not %v", len(order.Payments))
+	}
+	for i, amount := range []int{1, 2, 1} {
+		if order.Payments[i].Amount() != amount {
+			t.Errorf("order.Payments[%v].Amount() should be %v, not %v", i, amount, order.Payments[i].Amount())
+		}
+	}
+
+	order = orderFactory.MustCreateWithOption(map[string]interface{}{"Kind": "transfer"}).(*polyOrder)
+	if _, ok := order.Payment.(*polyTransfer); !ok {
+		t.Errorf("order.Payment should be *polyTransfer, not %T", order.Payment)
+	}
+
+	weighted := NewFactory(&polyOrder{}).
+		SubPolySliceFactory("Payments", ChooseWeighted(
+			Choice{Factory: cardFactory, Weight: 1},
+			Choice{Factory: transferFactory, Weight: 0},
+		), func() int { return 10 })
+	for _, p := range weighted.MustCreate().(*polyOrder).Payments {
+		if _, ok := p.(*polyCard); !ok {
+			t.Errorf("payments should be *polyCard, not %T", p)
+		}
+	}
+
+	invalid := NewFactory(&polyOrder{}).
+		SubPolyFactory("Payment", func(Args) (*Factory, error) {
+			return NewFactory(&polyOrder{}), nil
+		})
+	if _, err := invalid.Create(); err == nil {
+		t.Error("Create should fail for a model which does not implement the interface")
+	}
+}
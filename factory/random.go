@@ -0,0 +1,90 @@
+package factory
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// random is the source of randomness shared by all factories.
+var random = newLockedRand(time.Now().UnixNano())
+
+type lockedRand struct {
+	mu   sync.Mutex
+	seed int64
+	rnd  *rand.Rand
+}
+
+func newLockedRand(seed int64) *lockedRand {
+	return &lockedRand{seed: seed, rnd: rand.New(rand.NewSource(seed))}
+}
+
+func (lr *lockedRand) setSeed(seed int64) {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	lr.seed = seed
+	lr.rnd.Seed(seed)
+}
+
+func (lr *lockedRand) intn(n int) int {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rnd.Intn(n)
+}
+
+func (lr *lockedRand) int63n(n int64) int64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rnd.Int63n(n)
+}
+
+// int64Range returns a value in [min, max], which can span the whole int64 range.
+func (lr *lockedRand) int64Range(min, max int64) int64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	span := uint64(max - min) // the number of values minus 1, which wraps around correctly
+	switch {
+	case span < math.MaxInt64:
+		return min + lr.rnd.Int63n(int64(span)+1)
+	case span == math.MaxUint64:
+		return int64(lr.rnd.Uint64())
+	}
+	for {
+		// more than half of the draws are accepted
+		if v := lr.rnd.Uint64(); v <= span {
+			return min + int64(v)
+		}
+	}
+}
+
+func (lr *lockedRand) float64() float64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rnd.Float64()
+}
+
+func (lr *lockedRand) normFloat64() float64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return lr.rnd.NormFloat64()
+}
+
+// zipf returns a value drawn from z, which should use lr.rnd as its source.
+func (lr *lockedRand) zipf(z *rand.Zipf) uint64 {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+	return z.Uint64()
+}
+
+// SetSeed resets the random source used by factories, so random choices can be reproduced.
+func SetSeed(seed int64) {
+	random.setSeed(seed)
+}
+
+// Seed returns the seed of the random source used by factories.
+func Seed() int64 {
+	random.mu.Lock()
+	defer random.mu.Unlock()
+	return random.seed
+}
@@ -0,0 +1,201 @@
+package factory
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Registry holds factories by name, so they can be looked up by name or by model type.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]*Factory
+	names     []string // registration order
+	models    map[string]interface{}
+	providers map[string]func(Args) (interface{}, error)
+}
+
+// DefaultRegistry is the registry used by Register, Ref, Get and For.
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]*Factory),
+		models:    make(map[string]interface{}),
+		providers: make(map[string]func(Args) (interface{}, error)),
+	}
+}
+
+// Register registers fa under name.
+// It returns an error if another factory is already registered under the name.
+func (r *Registry) Register(name string, fa *Factory) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("factory: duplicate registration of %v", name)
+	}
+	r.factories[name] = fa
+	r.names = append(r.names, name)
+	return nil
+}
+
+// MustRegister is like Register but panics on error, and returns fa.
+func (r *Registry) MustRegister(name string, fa *Factory) *Factory {
+	if err := r.Register(name, fa); err != nil {
+		panic(err)
+	}
+	return fa
+}
+
+// Get returns the factory registered under name.
+func (r *Registry) Get(name string) (*Factory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	fa, ok := r.factories[name]
+	return fa, ok
+}
+
+// For returns the factory whose model has the same type as model, e.g. For((*User)(nil)).
+// It returns an error if no factory or more than one factory is registered for the type,
+// or if a registered lazy factory cannot be resolved yet, since it may be registered for the type.
+func (r *Registry) For(model interface{}) (*Factory, error) {
+	tp := reflect.TypeOf(model)
+	var found []string
+	var ret *Factory
+	var err error
+	r.Each(func(name string, fa *Factory) bool {
+		resolved, rerr := fa.tryResolve()
+		if rerr != nil {
+			err = fmt.Errorf("factory: failed to resolve factory %v: %w", name, rerr)
+			return false
+		}
+		if reflect.TypeOf(resolved.model) == tp {
+			found = append(found, name)
+			ret = fa
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("factory: no factory is registered for %v", tp)
+	case 1:
+		return ret, nil
+	}
+	return nil, fmt.Errorf("factory: %v factories are registered for %v: %v", len(found), tp, found)
+}
+
+// Names returns the names of the registered factories in registration order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.names...)
+}
+
+// Each calls fn for each registered factory in registration order until fn returns false.
+func (r *Registry) Each(fn func(name string, fa *Factory) bool) {
+	for _, name := range r.Names() {
+		fa, _ := r.Get(name)
+		if !fn(name, fa) {
+			return
+		}
+	}
+}
+
+// Ref returns a factory which refers to the factory registered under name.
+// It is resolved on first use, so package-level factories can refer to each other without initialization cycles.
+// Creating an object with it fails if no factory is registered under the name by then.
+func (r *Registry) Ref(name string) *Factory {
+	return &Factory{lazy: func() (*Factory, error) {
+		fa, ok := r.Get(name)
+		if !ok {
+			return nil, fmt.Errorf("factory: no factory is registered as %v", name)
+		}
+		return fa, nil
+	}}
+}
+
+// Register registers fa under name in DefaultRegistry, and returns fa.
+// It panics if another factory is already registered under the name.
+func Register(name string, fa *Factory) *Factory {
+	return DefaultRegistry.MustRegister(name, fa)
+}
+
+// Ref returns a factory which refers to the factory registered under name in DefaultRegistry.
+func Ref(name string) *Factory {
+	return DefaultRegistry.Ref(name)
+}
+
+// Get returns the factory registered under name in DefaultRegistry.
+func Get(name string) (*Factory, bool) {
+	return DefaultRegistry.Get(name)
+}
+
+// For returns the factory registered for the type of model in DefaultRegistry.
+func For(model interface{}) (*Factory, error) {
+	return DefaultRegistry.For(model)
+}
+
+// Lazy returns a factory which is resolved by calling get on first use.
+// It can be passed to sub-factory methods to refer to a factory which is initialized later, e.g. in init.
+// Go reports an initialization cycle for package-level factories which refer to each other even through get,
+// so use Ref for them instead.
+func Lazy(get func() *Factory) *Factory {
+	var fa *Factory
+	fa = &Factory{lazy: func() (*Factory, error) {
+		resolved := get()
+		if resolved == nil {
+			return nil, fmt.Errorf("factory: lazy factory %p is resolved to nil", fa)
+		}
+		return resolved, nil
+	}}
+	return fa
+}
+
+// resolve returns the factory which a lazy factory refers to, or fa itself.
+// It panics if the lazy factory cannot be resolved.
+func (fa *Factory) resolve() *Factory {
+	resolved, err := fa.tryResolve()
+	if err != nil {
+		panic(err)
+	}
+	return resolved
+}
+
+// tryResolve is like resolve but returns an error if the lazy factory cannot be resolved.
+// A failed resolution is retried on next use.
+// The chain of lazy factories is followed without holding their locks, so lazy factories which refer to each other are reported instead of deadlocking.
+func (fa *Factory) tryResolve() (*Factory, error) {
+	if fa.lazy == nil {
+		return fa, nil
+	}
+	seen := make(map[*Factory]bool)
+	cur := fa
+	for cur.lazy != nil {
+		if seen[cur] {
+			return nil, fmt.Errorf("factory: lazy factory %p refers to itself through other lazy factories", fa)
+		}
+		seen[cur] = true
+		cur.lazyMu.Lock()
+		resolved := cur.resolved
+		cur.lazyMu.Unlock()
+		if resolved != nil {
+			cur = resolved
+			break
+		}
+		next, err := cur.lazy()
+		if err != nil {
+			return nil, err
+		}
+		cur = next
+	}
+	fa.lazyMu.Lock()
+	defer fa.lazyMu.Unlock()
+	if fa.resolved == nil {
+		fa.resolved = cur
+	}
+	return fa.resolved, nil
+}
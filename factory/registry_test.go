@@ -0,0 +1,136 @@
+package factory
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type lazyUser struct {
+	ID     int
+	Group  *lazyGroup
+	Friend *lazyUser
+}
+
+type lazyGroup struct {
+	ID    int
+	Owner *lazyUser
+	Users []*lazyUser
+}
+
+var lazyUserFactory = Register("lazy-user", NewFactory(&lazyUser{}).
+	SeqInt("ID", func(n int) (interface{}, error) {
+		return n, nil
+	}).
+	BackRef("Group").
+	SubRecursiveFactory("Friend", Ref("lazy-user"), func() int { return 1 }))
+
+var lazyGroupFactory = NewFactory(&lazyGroup{}).
+	SubFactory("Owner", Lazy(func() *Factory { return lazyUserFactory })).
+	SubSliceFactory("Users", Ref("lazy-user"), func() int { return 2 })
+
+func TestLazyFactory(t *testing.T) {
+	group := lazyGroupFactory.MustCreate().(*lazyGroup)
+	if group.Owner == nil || group.Owner.Friend == nil {
+		t.Fatalf("group.Owner and its friend should be created: %+v", group.Owner)
+	}
+	if len(group.Users) != 2 {
+		t.Fatalf("len(group.Users) should be 2, not %v", len(group.Users))
+	}
+	for _, user := range group.Users {
+		if user.Group != group {
+			t.Error("user.Group should be the parent group")
+		}
+	}
+}
+
+func TestRefUnregistered(t *testing.T) {
+	r := NewRegistry()
+	groupFactory := NewFactory(&lazyGroup{}).SubFactory("Owner", r.Ref("user"))
+	if _, err := groupFactory.Create(); err == nil || err.Error() != "factory: no factory is registered as user" {
+		t.Errorf("Create should fail for an unregistered factory, not %v", err)
+	}
+
+	r.MustRegister("user", NewFactory(&lazyUser{}))
+	if group := groupFactory.MustCreate().(*lazyGroup); group.Owner == nil {
+		t.Error("group.Owner should be created once the factory is registered")
+	}
+}
+
+func TestRefCycle(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister("a", r.Ref("b"))
+	r.MustRegister("b", r.Ref("a"))
+	groupFactory := NewFactory(&lazyGroup{}).SubFactory("Owner", r.Ref("a"))
+	if _, err := groupFactory.Create(); err == nil || !strings.Contains(err.Error(), "refers to itself") {
+		t.Errorf("Create should fail for lazy factories which refer to each other, not %v", err)
+	}
+}
+
+func TestRegistryForUnresolved(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister("user", NewFactory(&lazyUser{}))
+	r.MustRegister("group", r.Ref("missing"))
+	if _, err := r.For(&lazyUser{}); err == nil || !strings.Contains(err.Error(), "no factory is registered as missing") {
+		t.Errorf("registry.For should return an error for an unresolved factory, not %v", err)
+	}
+
+	r.MustRegister("missing", NewFactory(&lazyGroup{}))
+	if fa, err := r.For(&lazyUser{}); err != nil || fa.ModelType() != reflect.TypeOf(&lazyUser{}) {
+		t.Errorf("registry.For should return the user factory once the reference is registered: %v", err)
+	}
+}
+
+func TestRegisterDuplicate(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("duplicate registration should panic")
+		}
+	}()
+	Register("lazy-user", NewFactory(&lazyUser{}))
+}
+
+func TestRegistry(t *testing.T) {
+	type User struct {
+		Name string
+	}
+	type Admin struct {
+		Name string
+	}
+
+	registry := NewRegistry()
+	userFactory := NewFactory(&User{})
+	if err := registry.Register("user", userFactory); err != nil {
+		t.Fatal(err)
+	}
+	if err := registry.Register("user", NewFactory(&User{})); err == nil {
+		t.Error("duplicate registration should cause an error")
+	}
+	registry.MustRegister("admin", NewFactory(&Admin{}))
+	registry.MustRegister("admin-ref", registry.Ref("admin"))
+
+	if fa, ok := registry.Get("user"); !ok || fa != userFactory {
+		t.Error(`registry.Get("user") should return userFactory`)
+	}
+	if _, ok := registry.Get("unknown"); ok {
+		t.Error(`registry.Get("unknown") should not return a factory`)
+	}
+	if fa, err := registry.For((*User)(nil)); err != nil || fa != userFactory {
+		t.Errorf("registry.For should return userFactory: %v", err)
+	}
+	if _, err := registry.For((*Admin)(nil)); err == nil {
+		t.Error("registry.For should return an error for a type registered twice")
+	}
+	if _, err := registry.For(&lazyUser{}); err == nil {
+		t.Error("registry.For should return an error for a type not registered")
+	}
+
+	var names []string
+	registry.Each(func(name string, fa *Factory) bool {
+		names = append(names, name)
+		return true
+	})
+	if len(names) != 3 || names[0] != "user" || names[1] != "admin" || names[2] != "admin-ref" {
+		t.Errorf("unexpected names: %v", names)
+	}
+}
@@ -0,0 +1,245 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Sequence generates numbers like 1, 2, 3, ... for Seq.
+// It is safe for concurrent use, so a sequence can be shared by several factories, e.g. for a single ID space.
+type Sequence struct {
+	mu     sync.Mutex
+	start  int64
+	step   int64
+	cycle  int64
+	format string
+	count  int64 // the number of values handed out
+
+	init        func(ctx context.Context) (int64, error)
+	file        string
+	initialized bool
+}
+
+// SeqOption configures a Sequence.
+type SeqOption func(*Sequence)
+
+// SeqStart sets the first value of a sequence. The default is 1.
+func SeqStart(n int64) SeqOption {
+	return func(s *Sequence) {
+		s.start = n
+	}
+}
+
+// SeqStep sets the difference between consecutive values of a sequence. The default is 1.
+func SeqStep(n int64) SeqOption {
+	return func(s *Sequence) {
+		s.step = n
+	}
+}
+
+// SeqCycle makes a sequence start over after n values.
+func SeqCycle(n int) SeqOption {
+	if n <= 0 {
+		panic("SeqCycle: n should be positive")
+	}
+	return func(s *Sequence) {
+		s.cycle = int64(n)
+	}
+}
+
+// SeqInit makes a sequence continue after the value returned by init, e.g. the maximum ID in a database.
+// A value before the start of the sequence is ignored, and a cyclic sequence continues its cycle after the value.
+// init is called with the context of the first create call which uses the sequence, and called again if it fails.
+func SeqInit(init func(ctx context.Context) (int64, error)) SeqOption {
+	return func(s *Sequence) {
+		s.init = init
+	}
+}
+
+// SeqFile makes a sequence continue after the value saved in the file, and save each value to it.
+// A missing file is created with the first value. The file is not locked against other processes.
+func SeqFile(path string) SeqOption {
+	return func(s *Sequence) {
+		s.file = path
+	}
+}
+
+// SeqFormat sets the fmt format of the values of a sequence for string attributes, e.g. "ORD-%06d".
+func SeqFormat(format string) SeqOption {
+	return func(s *Sequence) {
+		s.format = format
+	}
+}
+
+// SeqPad zero-pads the values of a sequence to width digits for string attributes.
+func SeqPad(width int) SeqOption {
+	return SeqFormat("%0" + strconv.Itoa(width) + "d")
+}
+
+// NewSequence returns a new sequence.
+func NewSequence(opts ...SeqOption) *Sequence {
+	s := &Sequence{start: 1, step: 1}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+var (
+	sequencesMu sync.Mutex
+	sequences   = make(map[string]*Sequence)
+)
+
+// NamedSequence returns the sequence with the name, which is created with opts on first call.
+// Factories which use the same name share the sequence.
+// Only the call which creates the sequence can give opts: it panics if opts are given for an existing name,
+// since which options would apply would depend on the initialization order.
+func NamedSequence(name string, opts ...SeqOption) *Sequence {
+	sequencesMu.Lock()
+	defer sequencesMu.Unlock()
+	s, ok := sequences[name]
+	if ok && len(opts) > 0 {
+		panic(fmt.Sprintf("NamedSequence: sequence %v is already created, so options cannot be given", name))
+	}
+	if !ok {
+		s = NewSequence(opts...)
+		sequences[name] = s
+	}
+	return s
+}
+
+// Next returns the next value of the sequence. ctx is passed to the function given by SeqInit.
+func (s *Sequence) Next(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.initialized {
+		if err := s.initialize(ctx); err != nil {
+			return 0, err
+		}
+		s.initialized = true
+	}
+	n := s.count
+	if s.cycle > 0 {
+		n %= s.cycle
+	}
+	v := s.start + n*s.step
+	if s.file != "" {
+		if err := s.save(v); err != nil {
+			return 0, err
+		}
+	}
+	s.count++
+	return v, nil
+}
+
+// initialize makes the sequence start after the last value obtained by SeqInit and SeqFile.
+func (s *Sequence) initialize(ctx context.Context) error {
+	found := false
+	var last int64
+	if s.init != nil {
+		v, err := s.init(ctx)
+		if err != nil {
+			return fmt.Errorf("factory: failed to initialize sequence: %w", err)
+		}
+		last, found = v, true
+	}
+	if s.file != "" {
+		data, err := ioutil.ReadFile(s.file)
+		switch {
+		case os.IsNotExist(err):
+		case err != nil:
+			return fmt.Errorf("factory: failed to initialize sequence: %w", err)
+		default:
+			v, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+			if err != nil {
+				return fmt.Errorf("factory: invalid sequence file %v: %w", s.file, err)
+			}
+			if !found || v > last {
+				last, found = v, true
+			}
+		}
+	}
+	if !found {
+		return nil
+	}
+	if s.cycle > 0 {
+		// continue the cycle after last, or start it over if last is not one of its values.
+		if d := last - s.start; s.step != 0 && d%s.step == 0 && d/s.step >= 0 && d/s.step < s.cycle {
+			s.count = d/s.step + 1
+		}
+		return nil
+	}
+	if (s.step > 0 && last >= s.start) || (s.step < 0 && last <= s.start) {
+		s.start = last + s.step
+	}
+	return nil
+}
+
+// save writes v to the file of the sequence through a temporary file, so a crash does not leave a broken file.
+func (s *Sequence) save(v int64) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(s.file), filepath.Base(s.file)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.WriteString(strconv.FormatInt(v, 10) + "\n"); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file)
+}
+
+// Format returns n formatted as a string value of the sequence.
+func (s *Sequence) Format(n int64) string {
+	if s.format == "" {
+		return strconv.FormatInt(n, 10)
+	}
+	return fmt.Sprintf(s.format, n)
+}
+
+// Seq sets the next value of seq to the attribute, converted to the type of the field:
+// numbers for numeric fields, and strings formatted by the sequence for string fields.
+func (fa *Factory) Seq(name string, seq *Sequence) *Factory {
+	idx := fa.checkIdx(name)
+	tp := fa.rt.Field(idx).Type
+	switch tp.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		if seq.format != "" {
+			panic(fmt.Sprintf("Seq: a sequence with format requires a string attribute, not %v", tp))
+		}
+		fa.setGen(idx, KindSeq, func(args Args) (interface{}, error) {
+			n, err := seq.Next(args.Context())
+			if err != nil {
+				return nil, err
+			}
+			return reflect.ValueOf(n).Convert(tp).Interface(), nil
+		})
+	case reflect.String:
+		fa.setGen(idx, KindSeq, func(args Args) (interface{}, error) {
+			n, err := seq.Next(args.Context())
+			if err != nil {
+				return nil, err
+			}
+			return reflect.ValueOf(seq.Format(n)).Convert(tp).Interface(), nil
+		})
+	default:
+		panic(fmt.Sprintf("Seq: a sequence requires a numeric or string attribute, not %v", tp))
+	}
+	return fa
+}
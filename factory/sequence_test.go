@@ -0,0 +1,192 @@
+package factory
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestFactorySeq(t *testing.T) {
+	type ID int64
+	type Order struct {
+		ID     ID
+		Number string
+		Shard  uint8
+		Code   string
+	}
+
+	orderFactory := NewFactory(&Order{}).
+		Seq("ID", NewSequence(SeqStart(100), SeqStep(10))).
+		Seq("Number", NewSequence(SeqFormat("ORD-%06d"))).
+		Seq("Shard", NewSequence(SeqStart(0), SeqCycle(3))).
+		Seq("Code", NewSequence(SeqPad(3)))
+
+	for i, expected := range []Order{
+		{ID: 100, Number: "ORD-000001", Shard: 0, Code: "001"},
+		{ID: 110, Number: "ORD-000002", Shard: 1, Code: "002"},
+		{ID: 120, Number: "ORD-000003", Shard: 2, Code: "003"},
+		{ID: 130, Number: "ORD-000004", Shard: 0, Code: "004"},
+	} {
+		order := orderFactory.MustCreate().(*Order)
+		if *order != expected {
+			t.Errorf("order %v should be %+v, not %+v", i, expected, *order)
+		}
+	}
+}
+
+func TestFactorySeqShared(t *testing.T) {
+	type User struct {
+		ID int
+	}
+	type Admin struct {
+		ID int
+	}
+
+	userFactory := NewFactory(&User{}).Seq("ID", NamedSequence("TestFactorySeqShared"))
+	adminFactory := NewFactory(&Admin{}).Seq("ID", NamedSequence("TestFactorySeqShared"))
+
+	var mu sync.Mutex
+	seen := make(map[int]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			id := userFactory.MustCreate().(*User).ID
+			mu.Lock()
+			defer mu.Unlock()
+			seen[id] = true
+		}()
+		go func() {
+			defer wg.Done()
+			id := adminFactory.MustCreate().(*Admin).ID
+			mu.Lock()
+			defer mu.Unlock()
+			seen[id] = true
+		}()
+	}
+	wg.Wait()
+	for id := 1; id <= 100; id++ {
+		if !seen[id] {
+			t.Errorf("ID %v should be used once by users or admins", id)
+		}
+	}
+}
+
+func TestNamedSequenceOptions(t *testing.T) {
+	t.Cleanup(func() {
+		sequencesMu.Lock()
+		defer sequencesMu.Unlock()
+		delete(sequences, "TestNamedSequenceOptions")
+	})
+	seq := NamedSequence("TestNamedSequenceOptions", SeqStart(1000))
+	if NamedSequence("TestNamedSequenceOptions") != seq {
+		t.Error("NamedSequence should return the existing sequence")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("NamedSequence should panic if options are given for an existing sequence")
+		}
+	}()
+	NamedSequence("TestNamedSequenceOptions", SeqStart(1))
+}
+
+type maxIDKey struct{}
+
+func TestFactorySeqInit(t *testing.T) {
+	type User struct {
+		ID int
+	}
+
+	calls := 0
+	seq := NewSequence(SeqInit(func(ctx context.Context) (int64, error) {
+		calls++
+		maxID, ok := ctx.Value(maxIDKey{}).(int64)
+		if !ok {
+			return 0, errors.New("no max ID")
+		}
+		return maxID, nil
+	}))
+	userFactory := NewFactory(&User{}).Seq("ID", seq)
+
+	if _, err := userFactory.Create(); err == nil {
+		t.Error("Create should fail when the sequence fails to initialize")
+	}
+	ctx := context.WithValue(context.Background(), maxIDKey{}, int64(41))
+	var wg sync.WaitGroup
+	ids := make([]int, 10)
+	for i := range ids {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ids[i] = userFactory.MustCreateWithContextAndOption(ctx, nil).(*User).ID
+		}(i)
+	}
+	wg.Wait()
+	seen := make(map[int]bool)
+	for _, id := range ids {
+		if id < 42 || id > 51 || seen[id] {
+			t.Errorf("IDs should be unique in [42, 51]: %v", ids)
+			break
+		}
+		seen[id] = true
+	}
+	if calls != 2 {
+		t.Errorf("init should be called until it succeeds, but it was called %v times", calls)
+	}
+}
+
+func TestFactorySeqFile(t *testing.T) {
+	type User struct {
+		ID int64
+	}
+
+	path := filepath.Join(t.TempDir(), "user.seq")
+	for run, expected := range []int64{1, 3} {
+		userFactory := NewFactory(&User{}).Seq("ID", NewSequence(SeqFile(path)))
+		userFactory.MustCreate()
+		if user := userFactory.MustCreate().(*User); user.ID != expected+1 {
+			t.Errorf("user.ID should be %v in run %v, not %v", expected+1, run, user.ID)
+		}
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4\n" {
+		t.Errorf("the file should contain the last value, not %q", data)
+	}
+}
+
+func TestFactorySeqInitCycle(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "shard.seq")
+	var values []int64
+	for run := 0; run < 2; run++ {
+		seq := NewSequence(SeqStart(0), SeqCycle(3), SeqFile(path))
+		for i := 0; i < 2; i++ {
+			v, err := seq.Next(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			values = append(values, v)
+		}
+	}
+	if !reflect.DeepEqual(values, []int64{0, 1, 2, 0}) {
+		t.Errorf("a cyclic sequence should continue its cycle from the file: %v", values)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("only the sequence file should be left, not %v files", len(files))
+	}
+
+	seq := NewSequence(SeqStart(1000), SeqInit(func(context.Context) (int64, error) {
+		return 0, nil
+	}))
+	if v, _ := seq.Next(context.Background()); v != 1000 {
+		t.Errorf("a value before the start should be ignored, but the sequence returned %v", v)
+	}
+}
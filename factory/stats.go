@@ -0,0 +1,155 @@
+package factory
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Stats holds the creation statistics of a factory.
+type Stats struct {
+	Factory   *Factory
+	Built     int64 // objects created successfully
+	Persisted int64 // objects whose OnCreate callback succeeded
+	Failed    int64 // creations which failed
+	// GenTime is the time spent generating attributes, excluding the time spent by sub-factories.
+	GenTime time.Duration
+	// HookTime is the time spent in OnCreate callbacks.
+	HookTime time.Duration
+}
+
+// Cost returns the total time spent by the factory itself.
+func (st Stats) Cost() time.Duration {
+	return st.GenTime + st.HookTime
+}
+
+type factoryStats struct {
+	built, persisted, failed, genTime, hookTime int64
+}
+
+var (
+	statsMu        sync.Mutex
+	statsFactories []*Factory
+)
+
+// recordStats records a creation by fa, and adds its elapsed time to the parent object's.
+func (fa *Factory) recordStats(pl *pipeline, elapsed, genTime, hookTime time.Duration, err error) {
+	fa.statsOnce.Do(func() {
+		statsMu.Lock()
+		defer statsMu.Unlock()
+		statsFactories = append(statsFactories, fa)
+	})
+	if err != nil {
+		atomic.AddInt64(&fa.stats.failed, 1)
+	} else {
+		atomic.AddInt64(&fa.stats.built, 1)
+		if fa.onCreate != nil {
+			atomic.AddInt64(&fa.stats.persisted, 1)
+		}
+	}
+	atomic.AddInt64(&fa.stats.genTime, int64(genTime))
+	atomic.AddInt64(&fa.stats.hookTime, int64(hookTime))
+	if pl != nil {
+		if parent, ok := pl.parent.(*argsStruct); ok {
+			atomic.AddInt64(&parent.subTime, int64(elapsed))
+		}
+	}
+}
+
+// Stats returns the creation statistics of the factory.
+func (fa *Factory) Stats() Stats {
+	fa = fa.resolve()
+	return Stats{
+		Factory:   fa,
+		Built:     atomic.LoadInt64(&fa.stats.built),
+		Persisted: atomic.LoadInt64(&fa.stats.persisted),
+		Failed:    atomic.LoadInt64(&fa.stats.failed),
+		GenTime:   time.Duration(atomic.LoadInt64(&fa.stats.genTime)),
+		HookTime:  time.Duration(atomic.LoadInt64(&fa.stats.hookTime)),
+	}
+}
+
+// StatsSnapshot holds the creation statistics of factories at a point in time.
+type StatsSnapshot map[*Factory]Stats
+
+// SnapshotStats returns the statistics of all factories which have created objects.
+func SnapshotStats() StatsSnapshot {
+	statsMu.Lock()
+	factories := append([]*Factory(nil), statsFactories...)
+	statsMu.Unlock()
+	snap := make(StatsSnapshot, len(factories))
+	for _, fa := range factories {
+		snap[fa] = fa.Stats()
+	}
+	return snap
+}
+
+// Diff returns the statistics since old was taken, e.g. around a test.
+// Factories which created nothing since then are omitted.
+func (snap StatsSnapshot) Diff(old StatsSnapshot) StatsSnapshot {
+	diff := make(StatsSnapshot)
+	for fa, st := range snap {
+		o := old[fa]
+		d := Stats{
+			Factory:   fa,
+			Built:     st.Built - o.Built,
+			Persisted: st.Persisted - o.Persisted,
+			Failed:    st.Failed - o.Failed,
+			GenTime:   st.GenTime - o.GenTime,
+			HookTime:  st.HookTime - o.HookTime,
+		}
+		if d.Built != 0 || d.Failed != 0 {
+			diff[fa] = d
+		}
+	}
+	return diff
+}
+
+// Top returns the statistics of at most n factories in descending order of cost. n <= 0 means all of them.
+func (snap StatsSnapshot) Top(n int) []Stats {
+	list := make([]Stats, 0, len(snap))
+	for _, st := range snap {
+		list = append(list, st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Cost() != list[j].Cost() {
+			return list[i].Cost() > list[j].Cost()
+		}
+		return list[i].Built > list[j].Built
+	})
+	if n > 0 && len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// WriteSummary writes a table of the top n factories by cost to w, e.g. at the end of TestMain.
+// Factories are shown by their names in DefaultRegistry, or by their model types.
+// Registered references which cannot be resolved yet are ignored.
+func (snap StatsSnapshot) WriteSummary(w io.Writer, n int) error {
+	names := make(map[*Factory]string)
+	DefaultRegistry.Each(func(name string, fa *Factory) bool {
+		// a reference which cannot be resolved yet has not created anything, so it has no row to name.
+		if resolved, err := fa.tryResolve(); err == nil {
+			names[resolved] = name
+		}
+		return true
+	})
+	if _, err := fmt.Fprintf(w, "%-30s %10s %10s %10s %14s %14s\n", "FACTORY", "BUILT", "PERSISTED", "FAILED", "GEN", "HOOK"); err != nil {
+		return err
+	}
+	for _, st := range snap.Top(n) {
+		name, ok := names[st.Factory]
+		if !ok {
+			name = reflect.TypeOf(st.Factory.model).String()
+		}
+		if _, err := fmt.Fprintf(w, "%-30s %10d %10d %10d %14v %14v\n", name, st.Built, st.Persisted, st.Failed, st.GenTime, st.HookTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package factory
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFactoryStats(t *testing.T) {
+	type Post struct {
+		ID int
+	}
+	type User struct {
+		ID    int
+		Posts []*Post
+	}
+
+	postFactory := NewFactory(&Post{}).
+		Attr("ID", func(Args) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return 1, nil
+		}).
+		OnCreate(func(Args) error { return nil })
+	userFactory := NewFactory(&User{}).
+		SubSliceFactory("Posts", postFactory, func() int { return 3 })
+	failFactory := NewFactory(&User{}).OnCreate(func(Args) error {
+		return errors.New("failed")
+	})
+
+	userFactory.MustCreate()
+	before := SnapshotStats()
+	userFactory.MustCreate()
+	userFactory.MustCreate()
+	failFactory.Create()
+	diff := SnapshotStats().Diff(before)
+
+	if len(diff) != 3 {
+		t.Fatalf("diff should have 3 factories, not %v", len(diff))
+	}
+	post := diff[postFactory]
+	if post.Built != 6 || post.Persisted != 6 || post.Failed != 0 {
+		t.Errorf("post stats should be 6 built, 6 persisted and 0 failed, not %+v", post)
+	}
+	if post.GenTime < 6*time.Millisecond {
+		t.Errorf("post.GenTime should be at least 6ms, not %v", post.GenTime)
+	}
+	user := diff[userFactory]
+	if user.Built != 2 || user.Persisted != 0 {
+		t.Errorf("user stats should be 2 built and 0 persisted, not %+v", user)
+	}
+	if user.GenTime >= post.GenTime {
+		t.Errorf("user.GenTime should exclude the time of sub-factories: %v >= %v", user.GenTime, post.GenTime)
+	}
+	if fail := diff[failFactory]; fail.Built != 0 || fail.Failed != 1 {
+		t.Errorf("fail stats should be 0 built and 1 failed, not %+v", fail)
+	}
+	if top := diff.Top(1); len(top) != 1 || top[0].Factory != postFactory {
+		t.Errorf("the top factory should be the post factory, not %+v", top)
+	}
+	if userFactory.Stats().Built != 3 {
+		t.Errorf("userFactory.Stats().Built should be 3, not %v", userFactory.Stats().Built)
+	}
+
+	// a reference which cannot be resolved yet should not break the summary
+	if _, ok := DefaultRegistry.Get("stats-unresolved"); !ok {
+		Register("stats-unresolved", Ref("stats-missing"))
+	}
+	var buf bytes.Buffer
+	if err := diff.WriteSummary(&buf, 2); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "*factory.Post ") {
+		t.Errorf("summary should list the post factory first:\n%v", buf.String())
+	}
+}
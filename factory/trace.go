@@ -0,0 +1,133 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Tracer is notified of each step of object creation, e.g. for debugging complex factories.
+// Its methods can be called concurrently when objects are created concurrently.
+type Tracer interface {
+	// EnterFactory is called when the factory of args starts to create an object.
+	EnterFactory(args Args)
+	// ExitFactory is called when the object is created or its creation fails with err.
+	ExitFactory(args Args, elapsed time.Duration, err error)
+	// Attr is called when an attribute is generated.
+	Attr(args Args, event AttrEvent)
+	// Hook is called when a callback like OnCreate is executed.
+	Hook(args Args, name string, elapsed time.Duration, err error)
+}
+
+// AttrSource is where the value of an attribute comes from.
+type AttrSource string
+
+const (
+	SourceOverride   AttrSource = "override" // a value given at creation time
+	SourceDefault    AttrSource = "default"  // the value of the model given to NewFactory
+	SourceGenerator  AttrSource = "generator"
+	SourceSubFactory AttrSource = "subfactory"
+	SourceNull       AttrSource = "null" // the zero value chosen by Nullable
+)
+
+// AttrEvent describes a generated attribute.
+type AttrEvent struct {
+	Name    string
+	Source  AttrSource
+	Value   interface{} // nil if the attribute is not set
+	Elapsed time.Duration
+	Err     error
+}
+
+type tracerKey struct{}
+
+var (
+	globalTracerMu sync.RWMutex
+	globalTracer   Tracer
+)
+
+// WithTracer returns a context which makes factories notify tr of the creation with the context.
+func WithTracer(ctx context.Context, tr Tracer) context.Context {
+	return context.WithValue(ctx, tracerKey{}, tr)
+}
+
+// SetTracer sets a tracer which is notified of every creation without a tracer in its context. nil disables it.
+func SetTracer(tr Tracer) {
+	globalTracerMu.Lock()
+	defer globalTracerMu.Unlock()
+	globalTracer = tr
+}
+
+func tracerFrom(ctx context.Context) Tracer {
+	if ctx != nil {
+		if tr, ok := ctx.Value(tracerKey{}).(Tracer); ok {
+			return tr
+		}
+	}
+	globalTracerMu.RLock()
+	defer globalTracerMu.RUnlock()
+	return globalTracer
+}
+
+// TestLogger is the subset of testing.TB used by NewTestTracer.
+type TestLogger interface {
+	Helper()
+	Logf(format string, args ...interface{})
+}
+
+// NewTreeTracer returns a tracer which writes the creation as an indented tree to w.
+func NewTreeTracer(w io.Writer) Tracer {
+	return &treeTracer{logf: func(format string, args ...interface{}) {
+		fmt.Fprintf(w, format+"\n", args...)
+	}}
+}
+
+// NewTestTracer returns a tracer which logs the creation as an indented tree to t.
+func NewTestTracer(t TestLogger) Tracer {
+	return &treeTracer{logf: func(format string, args ...interface{}) {
+		t.Helper()
+		t.Logf(format, args...)
+	}}
+}
+
+type treeTracer struct {
+	mu   sync.Mutex
+	logf func(format string, args ...interface{})
+}
+
+func (tt *treeTracer) log(args Args, format string, a ...interface{}) {
+	tt.mu.Lock()
+	defer tt.mu.Unlock()
+	tt.logf(strings.Repeat("  ", args.Depth())+format, a...)
+}
+
+func (tt *treeTracer) EnterFactory(args Args) {
+	tt.log(args, "> %v (%v)", args.Factory().ModelType(), args.Path())
+}
+
+func (tt *treeTracer) ExitFactory(args Args, elapsed time.Duration, err error) {
+	if err != nil {
+		tt.log(args, "< %v failed in %v: %v", args.Factory().ModelType(), elapsed, err)
+		return
+	}
+	tt.log(args, "< %v (%v)", args.Factory().ModelType(), elapsed)
+}
+
+func (tt *treeTracer) Attr(args Args, event AttrEvent) {
+	if event.Err != nil {
+		tt.log(args, "  %v failed (%v, %v): %v", event.Name, event.Source, event.Elapsed, event.Err)
+		return
+	}
+	tt.log(args, "  %v = %#v (%v, %v)", event.Name, event.Value, event.Source, event.Elapsed)
+}
+
+func (tt *treeTracer) Hook(args Args, name string, elapsed time.Duration, err error) {
+	if err != nil {
+		tt.log(args, "  %v failed (%v): %v", name, elapsed, err)
+		return
+	}
+	tt.log(args, "  %v (%v)", name, elapsed)
+}
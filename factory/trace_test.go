@@ -0,0 +1,102 @@
+package factory
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordingTracer struct {
+	events []string
+}
+
+func (rt *recordingTracer) EnterFactory(args Args) {
+	rt.events = append(rt.events, "enter "+args.Path())
+}
+
+func (rt *recordingTracer) ExitFactory(args Args, elapsed time.Duration, err error) {
+	if err != nil {
+		rt.events = append(rt.events, "exit "+args.Path()+" "+err.Error())
+		return
+	}
+	rt.events = append(rt.events, "exit "+args.Path())
+}
+
+func (rt *recordingTracer) Attr(args Args, event AttrEvent) {
+	rt.events = append(rt.events, event.Name+" "+string(event.Source))
+}
+
+func (rt *recordingTracer) Hook(args Args, name string, elapsed time.Duration, err error) {
+	rt.events = append(rt.events, name)
+}
+
+func TestFactoryTracer(t *testing.T) {
+	type Group struct {
+		ID int
+	}
+	type User struct {
+		ID       int
+		Name     string
+		Location string
+		Group    *Group
+	}
+
+	groupFactory := NewFactory(&Group{}).SeqInt("ID", func(n int) (interface{}, error) {
+		return n, nil
+	})
+	userFactory := NewFactory(&User{Location: "Tokyo"}).
+		SeqInt("ID", func(n int) (interface{}, error) {
+			return n, nil
+		}).
+		SubFactory("Group", groupFactory).
+		OnCreate(func(Args) error { return nil })
+
+	tr := &recordingTracer{}
+	ctx := WithTracer(context.Background(), tr)
+	userFactory.MustCreateWithContextAndOption(ctx, map[string]interface{}{"Name": "bluele"})
+	expected := []string{
+		"enter User",
+		"ID generator",
+		"Name override",
+		"Location default",
+		"enter User.Group",
+		"ID generator",
+		"exit User.Group",
+		"Group subfactory",
+		"OnCreate",
+		"exit User",
+	}
+	if strings.Join(tr.events, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("events should be %q, not %q", expected, tr.events)
+	}
+
+	tr = &recordingTracer{}
+	ctx = WithTracer(context.Background(), tr)
+	fail := NewFactory(&User{}).Attr("Name", func(Args) (interface{}, error) {
+		return nil, errors.New("failed")
+	})
+	if _, err := fail.CreateWithContext(ctx); err == nil {
+		t.Error("CreateWithContext should fail")
+	}
+	if last := tr.events[len(tr.events)-1]; last != "exit User failed" {
+		t.Errorf("the last event should be the failure, not %q", last)
+	}
+
+	var buf bytes.Buffer
+	SetTracer(NewTreeTracer(&buf))
+	userFactory.MustCreate()
+	SetTracer(nil)
+	out := buf.String()
+	for _, line := range []string{"> *factory.User (User)", "  ID = 2 (generator, ", "  > *factory.Group (User.Group)", "< *factory.User ("} {
+		if !strings.Contains(out, line) {
+			t.Errorf("tree should contain %q:\n%v", line, out)
+		}
+	}
+	userFactory.MustCreate()
+	if out != buf.String() {
+		t.Error("SetTracer(nil) should disable the tracer")
+	}
+}
@@ -0,0 +1,49 @@
+package factory
+
+import "fmt"
+
+// TraitsAttr is the attribute name which applies traits at creation time,
+// e.g. map[string]interface{}{factory.TraitsAttr: factory.Traits{"admin"}}.
+const TraitsAttr = "$traits"
+
+// Traits is a list of trait names registered by Factory.Trait.
+type Traits []string
+
+// Trait registers a named set of attribute values.
+// The values are used as if they were given at creation time, but explicitly given values take precedence.
+func (fa *Factory) Trait(name string, opt map[string]interface{}) *Factory {
+	if fa.traits == nil {
+		fa.traits = make(map[string]map[string]interface{})
+	}
+	fa.traits[name] = opt
+	return fa
+}
+
+// applyTraits returns the attribute values which the traits in opt are merged into.
+func (fa *Factory) applyTraits(opt map[string]interface{}) (map[string]interface{}, error) {
+	v, ok := opt[TraitsAttr]
+	if !ok {
+		return opt, nil
+	}
+	names, ok := v.(Traits)
+	if !ok {
+		return nil, fmt.Errorf("%v should be factory.Traits, not %T", TraitsAttr, v)
+	}
+
+	merged := make(map[string]interface{})
+	for _, name := range names {
+		trait, ok := fa.traits[name]
+		if !ok {
+			return nil, fmt.Errorf("%v has no trait %v", fa.modelName(), name)
+		}
+		for k, v := range trait {
+			merged[k] = v
+		}
+	}
+	for k, v := range opt {
+		if k != TraitsAttr {
+			merged[k] = v
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,34 @@
+package factory
+
+import "testing"
+
+func TestFactoryTraits(t *testing.T) {
+	type User struct {
+		Name  string
+		Role  string
+		Admin bool
+	}
+
+	userFactory := NewFactory(&User{Name: "bluele", Role: "member"}).
+		Trait("admin", map[string]interface{}{"Role": "admin", "Admin": true}).
+		Trait("guest", map[string]interface{}{"Role": "guest"})
+
+	user := userFactory.MustCreateWithOption(map[string]interface{}{
+		TraitsAttr: Traits{"admin"},
+	}).(*User)
+	if user.Role != "admin" || !user.Admin {
+		t.Errorf("user should be an admin, not %+v", user)
+	}
+
+	user = userFactory.MustCreateWithOption(map[string]interface{}{
+		TraitsAttr: Traits{"admin", "guest"},
+		"Name":     "jun",
+	}).(*User)
+	if user.Role != "guest" || !user.Admin || user.Name != "jun" {
+		t.Errorf("unexpected user: %+v", user)
+	}
+
+	if _, err := userFactory.CreateWithOption(map[string]interface{}{TraitsAttr: Traits{"unknown"}}); err == nil {
+		t.Error("unknown trait should cause an error")
+	}
+}
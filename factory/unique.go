@@ -0,0 +1,144 @@
+package factory
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// MaxUniqueAttempts is the number of times an attribute is generated to satisfy a unique constraint.
+var MaxUniqueAttempts = 100
+
+// UniqueError is returned when a factory cannot generate unique values.
+type UniqueError struct {
+	Model    reflect.Type
+	Attrs    []string
+	Attempts int // 0 if the values cannot be regenerated
+}
+
+func (e *UniqueError) Error() string {
+	if e.Attempts == 0 {
+		return fmt.Sprintf("factory: duplicate %v of %v", strings.Join(e.Attrs, ", "), e.Model)
+	}
+	return fmt.Sprintf("factory: could not generate unique %v of %v in %v attempts", strings.Join(e.Attrs, ", "), e.Model, e.Attempts)
+}
+
+type uniqueConstraint struct {
+	names []string
+	idx   []int
+	mu    sync.Mutex
+	seen  map[string]bool
+}
+
+// addKey records key, and returns false if it is already recorded.
+func addKey(seen map[string]bool, key string) bool {
+	if seen[key] {
+		return false
+	}
+	seen[key] = true
+	return true
+}
+
+type uniqueScopeKey struct{}
+
+type uniqueScope struct {
+	mu   sync.Mutex
+	seen map[*uniqueConstraint]map[string]bool
+}
+
+// WithUniqueScope returns a context in which unique values are tracked separately.
+// By default they are tracked for the lifetime of the factory, so this is useful e.g. for a test with a fresh database.
+func WithUniqueScope(ctx context.Context) context.Context {
+	return context.WithValue(ctx, uniqueScopeKey{}, &uniqueScope{seen: make(map[*uniqueConstraint]map[string]bool)})
+}
+
+// Unique declares that the combination of the attributes is unique among the created objects.
+// On collision, the attributes which are generated are regenerated up to MaxUniqueAttempts times.
+func (fa *Factory) Unique(names ...string) *Factory {
+	if len(names) == 0 {
+		panic("factory: Unique requires attribute names")
+	}
+	uc := &uniqueConstraint{names: names, seen: make(map[string]bool)}
+	for _, name := range names {
+		uc.idx = append(uc.idx, fa.checkIdx(name))
+	}
+	fa.uniques = append(fa.uniques, uc)
+	return fa
+}
+
+// tryAdd records the values of the constraint in the object, and returns false if they are already recorded.
+// release removes the recorded values, e.g. when the object is rejected.
+func (uc *uniqueConstraint) tryAdd(ctx context.Context, inst *reflect.Value) (release func(), ok bool) {
+	var b strings.Builder
+	for _, idx := range uc.idx {
+		fmt.Fprintf(&b, "%#v\x00", inst.Field(idx))
+	}
+	key := b.String()
+	mu, seen := &uc.mu, uc.seen
+	if ctx != nil {
+		if us, ok := ctx.Value(uniqueScopeKey{}).(*uniqueScope); ok {
+			us.mu.Lock()
+			if us.seen[uc] == nil {
+				us.seen[uc] = make(map[string]bool)
+			}
+			mu, seen = &us.mu, us.seen[uc]
+			us.mu.Unlock()
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if !addKey(seen, key) {
+		return nil, false
+	}
+	return func() {
+		mu.Lock()
+		defer mu.Unlock()
+		delete(seen, key)
+	}, true
+}
+
+// checkUnique regenerates the attributes of the object until it satisfies the unique constraints.
+// The values are recorded in args.reserved until the object is accepted or rejected.
+func (fa *Factory) checkUnique(args *argsStruct, inst *reflect.Value, opt map[string]interface{}, tr Tracer) error {
+	for _, uc := range fa.uniques {
+		var regen []int
+		for _, idx := range uc.idx {
+			ag := fa.attrGens[idx]
+			if _, ok := opt[ag.key]; !ok && ag.genFunc != nil {
+				regen = append(regen, idx)
+			}
+		}
+		attempts := 1
+		for {
+			release, ok := uc.tryAdd(args.ctx, inst)
+			if ok {
+				args.reserved = append(args.reserved, release)
+				break
+			}
+			if len(regen) == 0 {
+				return &UniqueError{Model: fa.ModelType(), Attrs: uc.names}
+			}
+			if attempts >= MaxUniqueAttempts {
+				return &UniqueError{Model: fa.ModelType(), Attrs: uc.names, Attempts: attempts}
+			}
+			for _, idx := range regen {
+				fa.resetAttr(args, inst, idx)
+				if err := fa.setAttr(args, inst, idx, opt, tr); err != nil {
+					return err
+				}
+			}
+			attempts++
+		}
+	}
+	return nil
+}
+
+// releaseUnique removes the unique values recorded for the object, which is rejected.
+func (args *argsStruct) releaseUnique() {
+	for _, release := range args.reserved {
+		release()
+	}
+	args.reserved = nil
+}
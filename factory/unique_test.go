@@ -0,0 +1,97 @@
+package factory
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFactoryUnique(t *testing.T) {
+	type User struct {
+		Email string
+		Org   int
+		Slug  string
+	}
+
+	next := 0
+	userFactory := NewFactory(&User{}).
+		Attr("Email", func(Args) (interface{}, error) {
+			next++
+			return []string{"a", "b", "a", "a", "c"}[next%5], nil
+		}).
+		Attr("Org", func(Args) (interface{}, error) {
+			return 1, nil
+		}).
+		Unique("Email")
+
+	seen := make(map[string]bool)
+	for i := 0; i < 3; i++ {
+		user := userFactory.MustCreate().(*User)
+		if seen[user.Email] {
+			t.Errorf("user.Email should be unique: %v", user.Email)
+		}
+		seen[user.Email] = true
+	}
+	_, err := userFactory.Create()
+	var uerr *UniqueError
+	if !errors.As(err, &uerr) || uerr.Attempts != MaxUniqueAttempts {
+		t.Errorf("Create should fail with UniqueError after %v attempts, not %v", MaxUniqueAttempts, err)
+	}
+
+	ctx := WithUniqueScope(context.Background())
+	if _, err := userFactory.CreateWithContext(ctx); err != nil {
+		t.Errorf("a new unique scope should accept used values: %v", err)
+	}
+
+	slugFactory := NewFactory(&User{Org: 1}).Unique("Org", "Slug")
+	slugFactory.MustCreateWithOption(map[string]interface{}{"Slug": "home"})
+	slugFactory.MustCreateWithOption(map[string]interface{}{"Slug": "about"})
+	slugFactory.MustCreateWithOption(map[string]interface{}{"Org": 2, "Slug": "home"})
+	_, err = slugFactory.CreateWithOption(map[string]interface{}{"Slug": "home"})
+	if !errors.As(err, &uerr) || uerr.Attempts != 0 {
+		t.Errorf("Create should fail with UniqueError for the duplicate slug, not %v", err)
+	}
+}
+
+func TestFactoryUniqueRejected(t *testing.T) {
+	type User struct {
+		Email string
+		Age   int
+	}
+
+	ages := 0
+	userFactory := NewFactory(&User{}).
+		Attr("Age", func(Args) (interface{}, error) {
+			ages++
+			return ages, nil
+		}).
+		Unique("Email").
+		Validate(func(args Args) error {
+			if args.Instance().(*User).Age%2 == 1 {
+				return errors.New("Age should be even")
+			}
+			return nil
+		}).
+		ValidateAttempts(5)
+	opt := map[string]interface{}{"Email": "a@example.com"}
+	if _, err := userFactory.CreateWithOption(opt); err != nil {
+		t.Fatalf("the email of a rejected object should not be recorded: %v", err)
+	}
+
+	fail := true
+	persisted := NewFactory(&User{}).
+		Unique("Email").
+		OnCreate(func(Args) error {
+			if fail {
+				return errors.New("insert failed")
+			}
+			return nil
+		})
+	if _, err := persisted.CreateWithOption(opt); err == nil {
+		t.Fatal("Create should fail when OnCreate fails")
+	}
+	fail = false
+	if _, err := persisted.CreateWithOption(opt); err != nil {
+		t.Errorf("the email of an object which failed OnCreate should not be recorded: %v", err)
+	}
+}
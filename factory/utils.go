@@ -5,14 +5,25 @@ import (
 	"strings"
 )
 
+// getAttrName returns the attribute name given by the tag like `factory:"name,optional"`, or the field name.
 func getAttrName(sf reflect.StructField, tagName string) string {
-	tag := sf.Tag.Get(tagName)
+	tag := strings.Split(sf.Tag.Get(tagName), ",")[0]
 	if tag != "" {
 		return tag
 	}
 	return sf.Name
 }
 
+// hasTagFlag reports whether the tag like `factory:"name,optional"` has the flag.
+func hasTagFlag(sf reflect.StructField, tagName, flag string) bool {
+	for _, f := range strings.Split(sf.Tag.Get(tagName), ",")[1:] {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
+
 func setValueWithAttrPath(inst *reflect.Value, tp reflect.Type, attr string, v interface{}) bool {
 	attrs := strings.Split(attr, ".")
 	if len(attrs) <= 1 {
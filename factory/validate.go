@@ -0,0 +1,93 @@
+package factory
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Validator is implemented by models which can validate themselves. See ValidateModel.
+type Validator interface {
+	Validate() error
+}
+
+// ValidationError is returned when a created object does not pass validation.
+type ValidationError struct {
+	Model    reflect.Type
+	Attempts int
+	// Seed is the seed of the random source, to reproduce the failure with SetSeed.
+	Seed int64
+	Err  error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("factory: invalid %v after %v attempts (seed %v): %v", e.Model, e.Attempts, e.Seed, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate adds a check of invariants, e.g. cross-field constraints, which is called after the attributes are generated and before OnCreate.
+func (fa *Factory) Validate(fn func(Args) error) *Factory {
+	fa.validators = append(fa.validators, fn)
+	return fa
+}
+
+// ValidateModel makes the factory call the Validate method of objects which implement Validator, like Validate.
+func (fa *Factory) ValidateModel() *Factory {
+	fa.validateModel = true
+	return fa
+}
+
+// ValidateAttempts makes the factory regenerate an object which does not pass validation, up to n attempts in total.
+// By default an invalid object is not regenerated.
+// Attributes created by sub-factories are not regenerated, so rejected attempts do not create objects, e.g. rows in a database, in vain.
+func (fa *Factory) ValidateAttempts(n int) *Factory {
+	fa.validateAttempts = n
+	return fa
+}
+
+// validate checks the object, and regenerates it until it passes the checks.
+func (fa *Factory) validate(args *argsStruct, inst *reflect.Value, tp reflect.Type, opt map[string]interface{}, tr Tracer) error {
+	for attempts := 1; ; attempts++ {
+		err := fa.check(args, inst, tr)
+		if err == nil {
+			return nil
+		}
+		if attempts >= fa.validateAttempts {
+			return &ValidationError{Model: fa.ModelType(), Attempts: attempts, Seed: Seed(), Err: err}
+		}
+		args.releaseUnique()
+		if err := fa.generate(args, inst, tp, opt, tr, true); err != nil {
+			return err
+		}
+	}
+}
+
+// check calls the validators of the object.
+func (fa *Factory) check(args *argsStruct, inst *reflect.Value, tr Tracer) error {
+	if len(fa.validators) == 0 && !fa.validateModel {
+		return nil
+	}
+	start := time.Now()
+	err := fa.runValidators(args, inst)
+	if tr != nil {
+		tr.Hook(args, "Validate", time.Since(start), err)
+	}
+	return err
+}
+
+func (fa *Factory) runValidators(args *argsStruct, inst *reflect.Value) error {
+	for _, fn := range fa.validators {
+		if err := fn(args); err != nil {
+			return err
+		}
+	}
+	if fa.validateModel {
+		if v, ok := inst.Addr().Interface().(Validator); ok {
+			return v.Validate()
+		}
+	}
+	return nil
+}
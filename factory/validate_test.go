@@ -0,0 +1,146 @@
+package factory
+
+import (
+	"errors"
+	"testing"
+)
+
+type validatedEvent struct {
+	StartAt int
+	EndAt   int
+}
+
+func (e *validatedEvent) Validate() error {
+	if e.StartAt == e.EndAt {
+		return errors.New("StartAt should not equal EndAt")
+	}
+	return nil
+}
+
+func TestFactoryValidate(t *testing.T) {
+	n := 0
+	eventFactory := NewFactory(&validatedEvent{}).
+		Attr("StartAt", func(Args) (interface{}, error) {
+			n++
+			return n % 3, nil
+		}).
+		Attr("EndAt", func(Args) (interface{}, error) {
+			return 1, nil
+		}).
+		Validate(func(args Args) error {
+			e := args.Instance().(*validatedEvent)
+			if e.StartAt > e.EndAt {
+				return errors.New("StartAt should be before EndAt")
+			}
+			return nil
+		}).
+		ValidateModel().
+		ValidateAttempts(3)
+
+	// StartAt is generated as 1 (equal), 2 (after) and then 0.
+	event := eventFactory.MustCreate().(*validatedEvent)
+	if event.StartAt != 0 {
+		t.Errorf("event.StartAt should be 0, not %v", event.StartAt)
+	}
+
+	SetSeed(42)
+	_, err := eventFactory.ValidateAttempts(2).Create()
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Create should fail with ValidationError, not %v", err)
+	}
+	if verr.Attempts != 2 || verr.Seed != 42 {
+		t.Errorf("ValidationError should have 2 attempts and seed 42, not %+v", verr)
+	}
+	if verr.Unwrap().Error() != "StartAt should be before EndAt" {
+		t.Errorf("ValidationError should wrap the last error, not %v", verr.Unwrap())
+	}
+
+	_, err = eventFactory.CreateWithOption(map[string]interface{}{"StartAt": 1})
+	if !errors.As(err, &verr) || verr.Attempts != 2 {
+		t.Errorf("Create should fail with ValidationError for the invalid StartAt, not %v", err)
+	}
+}
+
+func TestFactoryValidateResetsAttrs(t *testing.T) {
+	type Profile struct {
+		Nickname *string
+		Email    string
+	}
+
+	nickname := "blue"
+	calls := 0
+	validated := 0
+	profileFactory := NewFactory(&Profile{}).
+		Attr("Nickname", func(Args) (interface{}, error) {
+			calls++
+			if calls == 1 {
+				return &nickname, nil
+			}
+			return nil, nil
+		}).
+		Validate(func(Args) error {
+			validated++
+			if validated == 1 {
+				return errors.New("rejected")
+			}
+			return nil
+		}).
+		ValidateAttempts(2)
+	if profile := profileFactory.MustCreate().(*Profile); profile.Nickname != nil {
+		t.Errorf("profile.Nickname should be reset before regeneration, not %v", *profile.Nickname)
+	}
+
+	emails := 0
+	uniqueFactory := NewFactory(&Profile{}).
+		Attr("Email", func(Args) (interface{}, error) {
+			emails++
+			if emails <= 2 {
+				return "a@example.com", nil
+			}
+			return nil, nil
+		}).
+		Unique("Email")
+	uniqueFactory.MustCreate()
+	if profile := uniqueFactory.MustCreate().(*Profile); profile.Email != "" {
+		t.Errorf("profile.Email should be reset before regeneration, not %v", profile.Email)
+	}
+}
+
+func TestFactoryValidateKeepsSubFactories(t *testing.T) {
+	type Account struct {
+		ID int
+	}
+	type Transfer struct {
+		Amount int
+		From   *Account
+	}
+
+	inserted := 0
+	accountFactory := NewFactory(&Account{}).OnCreate(func(Args) error {
+		inserted++
+		return nil
+	})
+	amounts := 0
+	transferFactory := NewFactory(&Transfer{}).
+		Attr("Amount", func(Args) (interface{}, error) {
+			amounts++
+			return amounts * 10, nil
+		}).
+		SubFactory("From", accountFactory).
+		Validate(func(args Args) error {
+			if args.Instance().(*Transfer).Amount < 30 {
+				return errors.New("Amount should be at least 30")
+			}
+			return nil
+		}).
+		ValidateAttempts(3)
+
+	transfer := transferFactory.MustCreate().(*Transfer)
+	if transfer.Amount != 30 {
+		t.Errorf("transfer.Amount should be 30, not %v", transfer.Amount)
+	}
+	if inserted != 1 || transfer.From == nil {
+		t.Errorf("the account should be created once and kept, but it was created %v times", inserted)
+	}
+}
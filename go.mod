@@ -1,3 +1,8 @@
 module github.com/bluele/factory-go
 
 go 1.15
+
+require (
+	github.com/Pallinder/go-randomdata v1.2.0
+	github.com/jinzhu/gorm v1.9.16
+)